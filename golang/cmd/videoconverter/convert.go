@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"imersaofc/internal/converter"
+	"imersaofc/internal/rabbitmq"
+)
+
+// runConvert implements `videoconverter convert --path <dir>`, converting a local chunk directory
+// without RabbitMQ or PostgreSQL.
+func runConvert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	path := flags.String("path", "", "directory containing the chunk files")
+	profile := flags.String("profile", "", "named encode profile from PROFILES_FILE")
+	chunkPattern := flags.String("chunk-pattern", "", "glob matching the chunk files (defaults to CHUNK_PATTERN)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("--path is required")
+	}
+
+	cfg, err := loadConverterConfig()
+	if err != nil {
+		return err
+	}
+
+	vc := converter.NewVideoConverter(nil, nil, converter.NewFFmpegEncoder(loadFFmpegConfig(1)), cfg)
+	result, err := vc.ConvertDirectory(context.Background(), *path, converter.ConvertOptions{
+		Profile:      *profile,
+		ChunkPattern: *chunkPattern,
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Conversion finished", slog.String("output_path", result.OutputPath), slog.Bool("subtitles", result.Subtitles))
+	return nil
+}
+
+// runSelfTest implements `videoconverter --selftest` and SELFTEST_ON_START: it pings PostgreSQL and
+// RabbitMQ, then converts a synthetic video with the configured pipeline, so environment problems show up
+// before the worker takes traffic.
+func runSelfTest(db *sql.DB, client *rabbitmq.RabbitClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("PostgreSQL is unreachable: %v", err)
+	}
+	if !client.IsConnected() {
+		return errors.New("RabbitMQ connection is closed")
+	}
+
+	cfg, err := loadConverterConfig()
+	if err != nil {
+		return err
+	}
+
+	vc := converter.NewVideoConverter(nil, nil, converter.NewFFmpegEncoder(loadFFmpegConfig(1)), cfg)
+	return vc.SelfTest(context.Background())
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"imersaofc/internal/rabbitmq"
+)
+
+// runHeartbeat logs the health of the RabbitMQ connection and the database every interval until ctx is
+// canceled, so log-only environments can tell a quiet worker from a dead one
+func runHeartbeat(ctx context.Context, interval time.Duration, client *rabbitmq.RabbitClient, db *sql.DB) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rabbitOK := client.IsConnected()
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		dbErr := db.PingContext(pingCtx)
+		cancel()
+
+		if rabbitOK && dbErr == nil {
+			slog.Info("Heartbeat: healthy")
+			continue
+		}
+		attrs := []any{slog.Bool("rabbitmq", rabbitOK), slog.Bool("postgres", dbErr == nil)}
+		if dbErr != nil {
+			attrs = append(attrs, slog.String("postgres_error", dbErr.Error()))
+		}
+		slog.Error("Heartbeat: unhealthy", attrs...)
+	}
+}
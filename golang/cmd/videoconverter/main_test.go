@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestStartWorkers(t *testing.T) {
+	const workers, deliveries = 3, 20
+
+	msgs := make(chan amqp.Delivery)
+	var running, peak, handled atomic.Int32
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+
+	wg := startWorkers(workers, msgs, func(d amqp.Delivery) {
+		now := running.Add(1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[d.DeliveryTag] = true
+		mu.Unlock()
+		handled.Add(1)
+		running.Add(-1)
+	})
+
+	for i := 1; i <= deliveries; i++ {
+		msgs <- amqp.Delivery{DeliveryTag: uint64(i)}
+	}
+	close(msgs)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers didn't finish after msgs was closed")
+	}
+
+	if handled.Load() != deliveries || len(seen) != deliveries {
+		t.Errorf("handled %d deliveries (%d distinct), want %d", handled.Load(), len(seen), deliveries)
+	}
+	if peak.Load() > workers {
+		t.Errorf("%d deliveries handled at once, want at most %d", peak.Load(), workers)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+)
+
+// startPprof serves the net/http/pprof handlers on their own listener, separate from the public HTTP
+// server, so profiles can be captured from a running worker (go tool pprof http://<addr>/debug/pprof/profile)
+func startPprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	slog.Warn("pprof endpoint enabled", slog.String("addr", addr))
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("pprof server stopped", slog.String("error", err.Error()))
+		}
+	}()
+}
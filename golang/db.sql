@@ -1,11 +1,71 @@
+-- Schema snapshot; the service applies the same schema from internal/migrations when RUN_MIGRATIONS is set
+
 CREATE TABLE processed_videos (
     video_id INT PRIMARY KEY,          
     status VARCHAR(50) NOT NULL,       
-    processed_at TIMESTAMP NOT NULL    
+    processed_at TIMESTAMP NOT NULL,
+    content_hash VARCHAR(64),
+    attempts INT NOT NULL DEFAULT 0,
+    claimed_at TIMESTAMP,
+    manifest_path TEXT,
+    output_bytes BIGINT,
+    duration DOUBLE PRECISION,
+    last_error TEXT,
+    result JSONB
 );
 
+CREATE INDEX processed_videos_status_idx ON processed_videos (status);
+
 CREATE TABLE process_errors_log (
     id SERIAL PRIMARY KEY,             
     error_details JSONB NOT NULL,      
     created_at TIMESTAMP NOT NULL      
-);
\ No newline at end of file
+);
+
+CREATE TABLE pending_cleanups (
+    path TEXT PRIMARY KEY,
+    video_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE pending_confirmations (
+    video_id INT PRIMARY KEY,
+    exchange VARCHAR(255) NOT NULL,
+    routing_key VARCHAR(255) NOT NULL,
+    queue VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    headers JSONB,
+    correlation_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE video_metadata (
+    video_id INT PRIMARY KEY,
+    duration DOUBLE PRECISION NOT NULL,
+    size BIGINT NOT NULL,
+    bit_rate BIGINT NOT NULL,
+    video_codec VARCHAR(50) NOT NULL,
+    audio_codec VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    probed_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE video_events (
+    id BIGSERIAL PRIMARY KEY,
+    video_id INT NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    detail TEXT,
+    worker_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX video_events_video_id_idx ON video_events (video_id, created_at);
+
+CREATE TABLE conversion_stages (
+    video_id INT NOT NULL,
+    stage VARCHAR(50) NOT NULL,
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    completed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (video_id, stage)
+);
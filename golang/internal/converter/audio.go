@@ -0,0 +1,55 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AudioTrack is an extra audio file muxed into the manifest with its language code
+type AudioTrack struct {
+	File     string
+	Language string
+}
+
+// audioTrackPrefix is the naming convention for language audio files, e.g. audio_en.m4a, audio_pt-BR.aac
+const audioTrackPrefix = "audio_"
+
+// findAudioTracks returns the extra audio tracks for the task, either from its explicit file→language
+// mapping or by the audio_<lang>.<ext> naming convention. None means the input's own audio is used.
+func (vc *VideoConverter) findAudioTracks(task VideoTask) ([]AudioTrack, error) {
+	var tracks []AudioTrack
+
+	if len(task.AudioTracks) > 0 {
+		for file, language := range task.AudioTracks {
+			if language == "" {
+				return nil, fmt.Errorf("%w: audio track %s has no language", ErrInputRejected, file)
+			}
+			path := filepath.Join(task.Path, filepath.Base(file))
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("%w: audio track %s not found: %v", ErrInputRejected, file, err)
+			}
+			tracks = append(tracks, AudioTrack{File: path, Language: language})
+		}
+	} else {
+		files, err := filepath.Glob(filepath.Join(task.Path, audioTrackPrefix+"*"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find audio tracks: %v", err)
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			language := strings.TrimPrefix(name, audioTrackPrefix)
+			if language == "" {
+				continue
+			}
+			tracks = append(tracks, AudioTrack{File: file, Language: language})
+		}
+	}
+
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].File < tracks[j].File
+	})
+	return tracks, nil
+}
@@ -0,0 +1,214 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// BatchTask converts several videos from a single message. The body is either a JSON list of
+// VideoTasks, {"tasks": [...]}, or {"directory": "media/uploads"} where every subdirectory named
+// after a video id is converted.
+type BatchTask struct {
+	Version   int         `json:"version,omitempty"`
+	Tasks     []VideoTask `json:"tasks,omitempty"`
+	Directory string      `json:"directory,omitempty"`
+}
+
+// isBatch reports whether the message body holds a batch instead of a single VideoTask
+func isBatch(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return true
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return false
+	}
+	_, hasTasks := fields["tasks"]
+	_, hasDirectory := fields["directory"]
+	return hasTasks || hasDirectory
+}
+
+// MessageVideoIDs returns the video ids a conversion message refers to, whether it's a single task, a
+// batch or an S3 event; nil when the body can't be decoded
+func MessageVideoIDs(body []byte) []int {
+	var tasks []VideoTask
+	switch {
+	case isS3Event(body):
+		tasks, _ = parseS3Event(body)
+	case isBatch(body):
+		if batch, err := parseBatch(body); err == nil {
+			tasks, _ = batch.resolveTasks()
+		}
+	default:
+		var task VideoTask
+		if json.Unmarshal(body, &task) == nil {
+			tasks = []VideoTask{task}
+		}
+	}
+
+	var ids []int
+	for _, task := range tasks {
+		if task.VideoId > 0 {
+			ids = append(ids, task.VideoId)
+		}
+	}
+	return ids
+}
+
+// parseBatch decodes either accepted batch body format
+func parseBatch(body []byte) (*BatchTask, error) {
+	var batch BatchTask
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &batch.Tasks); err != nil {
+			return nil, err
+		}
+		return &batch, nil
+	}
+
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// resolveTasks returns the explicit task list or scans the batch directory for video folders
+func (b *BatchTask) resolveTasks() ([]VideoTask, error) {
+	if b.Directory == "" {
+		if len(b.Tasks) == 0 {
+			return nil, fmt.Errorf("batch has no tasks")
+		}
+		return b.Tasks, nil
+	}
+
+	entries, err := os.ReadDir(b.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan batch directory: %v", err)
+	}
+
+	var tasks []VideoTask
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		videoID, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, VideoTask{
+			Version: b.Version,
+			VideoId: videoID,
+			Path:    filepath.Join(b.Directory, entry.Name()),
+		})
+	}
+
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no video directories found in %s", b.Directory)
+	}
+	return tasks, nil
+}
+
+// handleBatch converts every video of a batch and acks only when all of them succeeded, requeueing it
+// otherwise. Videos already marked processed are skipped, so a redelivered batch resumes where it failed.
+func (vc *VideoConverter) handleBatch(ctx context.Context, d amqp.Delivery, conversionExch, confirmationKey, confirmationQueue string) {
+	batch, err := parseBatch(d.Body)
+	if err != nil {
+		vc.deadLetter(d, VideoTask{}, "Failed to unmarshal batch", err)
+		return
+	}
+
+	tasks, err := batch.resolveTasks()
+	if err != nil {
+		vc.deadLetter(d, VideoTask{}, "Invalid batch", err)
+		return
+	}
+
+	for _, task := range tasks {
+		if err := task.Validate(); err != nil {
+			vc.deadLetter(d, task, "Invalid task in batch", err)
+			return
+		}
+	}
+
+	var failed, rejected []int
+	completed, claimed := 0, 0
+	for i := range tasks {
+		task := &tasks[i]
+
+		// Em modo estrito cada confirmacao e gravada junto com o processed_videos do seu video, como no Handle
+		var pending *PendingConfirmation
+		var outbox func(*ConversionResult) *PendingConfirmation
+		if vc.cfg.StrictAck {
+			outbox = func(result *ConversionResult) *PendingConfirmation {
+				pending = vc.confirmation(*task, result, d.CorrelationId, confirmationHeaders(d), conversionExch, confirmationKey, confirmationQueue)
+				return pending
+			}
+		}
+
+		result, err := vc.convertTask(ctx, task, outbox)
+		if shouldDeadLetter(err) {
+			// entradas rejeitadas nunca vao converter, entao nao seguram o restante do lote
+			rejected = append(rejected, task.VideoId)
+			vc.publishFailure(*task, "Conversion failed permanently", err)
+			continue
+		}
+		if err != nil {
+			failed = append(failed, task.VideoId)
+			if errors.Is(err, ErrVideoClaimed) {
+				claimed++
+			}
+			continue
+		}
+		completed++
+
+		if result == nil {
+			continue
+		}
+		if vc.cfg.StrictAck {
+			if pending != nil {
+				vc.deliverStoredConfirmation(ctx, *pending)
+			}
+			continue
+		}
+		if err := vc.publishConfirmation(ctx, *task, result, d.CorrelationId, confirmationHeaders(d), conversionExch, confirmationKey, confirmationQueue); err != nil {
+			slog.Error("Failed to publish confirmation", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		}
+	}
+
+	if len(failed) > 0 {
+		// volta para a fila; na reentrega os videos concluidos sao pulados pelo IsProcessed
+		slog.Error("Batch partially failed",
+			slog.Int("completed", completed),
+			slog.Int("total", len(tasks)),
+			slog.Any("failed_video_ids", failed),
+			slog.Any("rejected_video_ids", rejected))
+		// so videos com claim de outro worker: espera como o Handle, senao o lote volta em loop ate o claim expirar
+		if claimed == len(failed) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(vc.cfg.ClaimRetryDelay):
+			}
+		}
+		if ctx.Err() == nil {
+			vc.requeue(d, VideoTask{})
+		}
+		return
+	}
+
+	vc.ack(d)
+	slog.Info("Batch processed", slog.Int("videos", len(tasks)), slog.Any("rejected_video_ids", rejected))
+}
@@ -0,0 +1,35 @@
+package converter
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+)
+
+// ffmpegBinary and ffprobeBinary are run by every invocation; SetBinaries replaces the PATH lookup
+var (
+	ffmpegBinary  = "ffmpeg"
+	ffprobeBinary = "ffprobe"
+)
+
+// SetBinaries sets the ffmpeg and ffprobe executables, failing when a configured one doesn't exist or isn't
+// executable. Empty names keep the PATH lookup. It must be called at startup, before any conversion runs.
+func SetBinaries(ffmpeg, ffprobe string) error {
+	if ffmpeg != "" {
+		path, err := exec.LookPath(ffmpeg)
+		if err != nil {
+			return fmt.Errorf("invalid ffmpeg binary: %v", err)
+		}
+		ffmpegBinary = path
+		slog.Info("Using ffmpeg binary", slog.String("path", path))
+	}
+	if ffprobe != "" {
+		path, err := exec.LookPath(ffprobe)
+		if err != nil {
+			return fmt.Errorf("invalid ffprobe binary: %v", err)
+		}
+		ffprobeBinary = path
+		slog.Info("Using ffprobe binary", slog.String("path", path))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerOutcome is what a handled delivery tells the breaker
+type breakerOutcome int
+
+const (
+	// outcomeNeutral says nothing about the health of the pipeline (duplicates, rejected inputs, batches)
+	outcomeNeutral breakerOutcome = iota
+	outcomeSuccess
+	outcomeFailure
+)
+
+// circuitBreaker stops deliveries from being handled after threshold consecutive conversion failures.
+// While open, workers block before taking a delivery, so nothing is pulled, acked or dead-lettered.
+// After cooldown a single trial delivery is let through (half-open): success closes the breaker,
+// failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	trial     bool // half-open: the trial delivery is being handled
+}
+
+// newCircuitBreaker returns nil (never trips) when threshold is not positive
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Wait blocks while the breaker is open or a half-open trial is running, or until ctx is canceled
+func (b *circuitBreaker) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		switch {
+		case b.state == breakerClosed:
+			b.mu.Unlock()
+			return nil
+		case b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown:
+			b.state = breakerHalfOpen
+			b.trial = true
+			b.mu.Unlock()
+			slog.Warn("Circuit breaker half-open, trying one conversion")
+			return nil
+		case b.state == breakerHalfOpen && !b.trial:
+			b.trial = true
+			b.mu.Unlock()
+			return nil
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Record reports the outcome of a delivery let through by Wait
+func (b *circuitBreaker) Record(outcome breakerOutcome) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.trial = false
+		switch outcome {
+		case outcomeSuccess:
+			b.state = breakerClosed
+			b.failures = 0
+			slog.Info("Circuit breaker closed, conversions are succeeding again")
+		case outcomeFailure:
+			b.state = breakerOpen
+			b.openedAt = time.Now()
+			slog.Error("Circuit breaker re-opened, trial conversion failed", slog.Duration("cooldown", b.cooldown))
+		}
+		return
+	}
+
+	switch outcome {
+	case outcomeSuccess:
+		b.failures = 0
+	case outcomeFailure:
+		b.failures++
+		if b.state == breakerClosed && b.failures >= b.threshold {
+			b.state = breakerOpen
+			b.openedAt = time.Now()
+			slog.Error("CIRCUIT BREAKER OPEN: every recent conversion failed, pausing consumption",
+				slog.Int("consecutive_failures", b.failures), slog.Duration("cooldown", b.cooldown))
+		}
+	}
+}
+
+// breakerOutcomeOf classifies the result of convertTask. Bad inputs and give-ups are the video's fault,
+// and an aborted session isn't a conversion failure, so none of them trip the breaker.
+func breakerOutcomeOf(result *ConversionResult, err error) breakerOutcome {
+	switch {
+	case err == nil && result != nil:
+		return outcomeSuccess
+	case err == nil, shouldDeadLetter(err), errors.Is(err, context.Canceled), errors.Is(err, ErrCanceled), errors.Is(err, ErrVideoClaimed):
+		return outcomeNeutral
+	default:
+		return outcomeFailure
+	}
+}
@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SubtitleStyle overrides how burned-in subtitles are drawn; zero values keep libass' defaults
+type SubtitleStyle struct {
+	// FontSize is the font size in libass units (the default is 18)
+	FontSize int
+	// FontColor is the text color as RRGGBB hex, e.g. "FFFF00" for yellow
+	FontColor string
+}
+
+// hexColor matches RRGGBB colors, with or without a leading #
+var hexColor = regexp.MustCompile(`^#?[0-9A-Fa-f]{6}$`)
+
+func (s SubtitleStyle) validate() error {
+	if s.FontSize < 0 {
+		return fmt.Errorf("subtitle font size must not be negative, got %d", s.FontSize)
+	}
+	if s.FontColor != "" && !hexColor.MatchString(s.FontColor) {
+		return fmt.Errorf("invalid subtitle font color %q, expected RRGGBB hex", s.FontColor)
+	}
+	return nil
+}
+
+// forceStyle returns the force_style value of the subtitles filter, empty when nothing is overridden.
+// ASS colors are written &HAABBGGRR, blue first.
+func (s SubtitleStyle) forceStyle() string {
+	var fields []string
+	if s.FontSize > 0 {
+		fields = append(fields, "FontSize="+strconv.Itoa(s.FontSize))
+	}
+	if s.FontColor != "" {
+		rgb := strings.ToUpper(strings.TrimPrefix(s.FontColor, "#"))
+		fields = append(fields, "PrimaryColour=&H00"+rgb[4:6]+rgb[2:4]+rgb[0:2])
+	}
+	return strings.Join(fields, ",")
+}
+
+// burnSubtitles reports whether the task's subtitles are rendered into the video instead of muxed as a
+// text track; the two are exclusive
+func (vc *VideoConverter) burnSubtitles(task VideoTask) bool {
+	return vc.cfg.Features.BurnSubtitles || task.BurnSubtitles
+}
+
+// findBurnInSubtitle returns the sidecar .srt or .vtt to burn in, empty when there is none. Only one
+// subtitle can be drawn, so with several the first by name wins.
+func findBurnInSubtitle(inputDir string) (string, error) {
+	var subtitles []string
+	for _, pattern := range []string{"*.srt", "*.vtt"} {
+		matches, err := filepath.Glob(filepath.Join(inputDir, pattern))
+		if err != nil {
+			return "", fmt.Errorf("failed to find subtitles: %v", err)
+		}
+		subtitles = append(subtitles, matches...)
+	}
+	if len(subtitles) == 0 {
+		return "", nil
+	}
+	sort.Strings(subtitles)
+	if len(subtitles) > 1 {
+		slog.Warn("Several subtitles found, burning in only the first",
+			slog.String("subtitle", subtitles[0]), slog.Int("found", len(subtitles)))
+	}
+	return subtitles[0], nil
+}
+
+// burnInFilter returns the video filter drawing opts.BurnSubtitles, empty when burn-in is off. A clip's
+// frames start at zero after the input seek, so they're shifted back to the source time while the
+// subtitles are drawn.
+func burnInFilter(opts EncodeOptions) string {
+	if opts.BurnSubtitles == "" {
+		return ""
+	}
+	filter := "subtitles=filename=" + filterOptionEscape(opts.BurnSubtitles)
+	if style := opts.SubtitleStyle.forceStyle(); style != "" {
+		filter += ":force_style=" + filterOptionEscape(style)
+	}
+	filter = filterGraphEscape(filter)
+	if opts.Start > 0 {
+		offset := strconv.FormatFloat(opts.Start, 'f', 3, 64)
+		filter = "setpts=PTS+" + offset + "/TB," + filter + ",setpts=PTS-STARTPTS"
+	}
+	return filter
+}
+
+// filterOptionEscape escapes a filter option value (first level of ffmpeg's filtergraph escaping)
+func filterOptionEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+}
+
+// filterGraphEscape escapes a filter description inside a filtergraph (second level)
+func filterGraphEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(s)
+}
+
+// joinFilters chains the non-empty video filters
+func joinFilters(filters ...string) string {
+	var chain []string
+	for _, filter := range filters {
+		if filter != "" {
+			chain = append(chain, filter)
+		}
+	}
+	return strings.Join(chain, ",")
+}
@@ -0,0 +1,77 @@
+package converter
+
+import "testing"
+
+func TestBurnInFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		opts EncodeOptions
+		want string
+	}{
+		{"disabled", EncodeOptions{}, ""},
+		{"plain path", EncodeOptions{BurnSubtitles: "/media/1/sub.srt"}, "subtitles=filename=/media/1/sub.srt"},
+		{"path with colon", EncodeOptions{BurnSubtitles: "/media/a:b/sub.srt"}, `subtitles=filename=/media/a\\:b/sub.srt`},
+		{"path with quote", EncodeOptions{BurnSubtitles: "/media/it's/sub.srt"}, `subtitles=filename=/media/it\\\'s/sub.srt`},
+		{
+			"font size and color",
+			EncodeOptions{BurnSubtitles: "/s.srt", SubtitleStyle: SubtitleStyle{FontSize: 24, FontColor: "#ff8800"}},
+			`subtitles=filename=/s.srt:force_style=FontSize=24\,PrimaryColour=&H000088FF`,
+		},
+		{
+			"clip offset",
+			EncodeOptions{BurnSubtitles: "/s.srt", Start: 12.5},
+			"setpts=PTS+12.500/TB,subtitles=filename=/s.srt,setpts=PTS-STARTPTS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := burnInFilter(tt.opts); got != tt.want {
+				t.Errorf("burnInFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForceStyle(t *testing.T) {
+	tests := []struct {
+		name  string
+		style SubtitleStyle
+		want  string
+	}{
+		{"defaults", SubtitleStyle{}, ""},
+		{"font size", SubtitleStyle{FontSize: 18}, "FontSize=18"},
+		// ASS guarda a cor como &HAABBGGRR: azul primeiro
+		{"yellow", SubtitleStyle{FontColor: "FFFF00"}, "PrimaryColour=&H0000FFFF"},
+		{"lowercase with hash", SubtitleStyle{FontColor: "#1a2b3c"}, "PrimaryColour=&H003C2B1A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.style.forceStyle(); got != tt.want {
+				t.Errorf("forceStyle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterEscaping(t *testing.T) {
+	tests := []struct {
+		in, option, graph string
+	}{
+		{"plain", "plain", "plain"},
+		{"a:b", `a\:b`, `a:b`},
+		{"it's", `it\'s`, `it\'s`},
+		{`back\slash`, `back\\slash`, `back\\slash`},
+		{"[in],x;y", "[in],x;y", `\[in\]\,x\;y`},
+	}
+
+	for _, tt := range tests {
+		if got := filterOptionEscape(tt.in); got != tt.option {
+			t.Errorf("filterOptionEscape(%q) = %q, want %q", tt.in, got, tt.option)
+		}
+		if got := filterGraphEscape(tt.in); got != tt.graph {
+			t.Errorf("filterGraphEscape(%q) = %q, want %q", tt.in, got, tt.graph)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// StatusCanceled is the status of a video whose conversion was canceled by an operator; redeliveries are
+// dropped until it's resubmitted with force
+const StatusCanceled = "canceled"
+
+// ControlActionCancel aborts the running conversion of the video
+const ControlActionCancel = "cancel"
+
+// ControlMessage is an operator command broadcast to every worker, e.g. {"action": "cancel", "video_id": 1}
+type ControlMessage struct {
+	Action  string `json:"action"`
+	VideoId int    `json:"video_id"`
+}
+
+// runningConversion is the inFlight entry of a conversion: its task path and how to cancel it
+type runningConversion struct {
+	path   string
+	cancel context.CancelCauseFunc
+}
+
+// Cancel aborts the conversion of videoID if it's running in this process, killing its ffmpeg runs.
+// It reports whether there was one.
+func (vc *VideoConverter) Cancel(videoID int) bool {
+	value, ok := vc.inFlight.Load(videoID)
+	if !ok {
+		return false
+	}
+	value.(*runningConversion).cancel(ErrCanceled)
+	return true
+}
+
+// HandleControl applies a control message. Every worker receives it, and only the one running the video
+// acts on it; a video that isn't running anywhere is left alone.
+func (vc *VideoConverter) HandleControl(d amqp.Delivery) {
+	var msg ControlMessage
+	if err := json.Unmarshal(d.Body, &msg); err != nil {
+		slog.Warn("Invalid control message", slog.String("error", err.Error()))
+		return
+	}
+
+	switch msg.Action {
+	case ControlActionCancel:
+		if vc.Cancel(msg.VideoId) {
+			slog.Info("Canceling conversion", slog.Int("video_id", msg.VideoId))
+		} else {
+			slog.Debug("Cancel for a video not running on this worker", slog.Int("video_id", msg.VideoId))
+		}
+	default:
+		slog.Warn("Unknown control action", slog.String("action", msg.Action), slog.Int("video_id", msg.VideoId))
+	}
+}
+
+// MarkCanceled moves the video to the canceled status
+func MarkCanceled(ctx context.Context, db *sql.DB, videoID int) error {
+	query := `INSERT INTO processed_videos (video_id, status, processed_at, attempts) VALUES ($1, $2, $3, 0)
+		ON CONFLICT (video_id) DO UPDATE SET status = EXCLUDED.status, processed_at = EXCLUDED.processed_at, claimed_at = NULL`
+	_, err := db.ExecContext(ctx, query, videoID, StatusCanceled, time.Now())
+	return dbError(err)
+}
+
+// canceled records a conversion that stopped because it was canceled and wraps its error with ErrCanceled
+func (vc *VideoConverter) canceled(task VideoTask, err error) error {
+	slog.Info("Conversion canceled", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+	vc.recordEvent(context.Background(), task.VideoId, EventCanceled, "")
+	if vc.db != nil {
+		ctx, cancel := vc.dbContext(context.Background())
+		defer cancel()
+		if dbErr := MarkCanceled(ctx, vc.db, task.VideoId); dbErr != nil {
+			slog.Error("Failed to mark video as canceled", slog.Int("video_id", task.VideoId), slog.String("error", dbErr.Error()))
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrCanceled, err)
+}
@@ -0,0 +1,88 @@
+package converter
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultChecksumAlgorithm is used when checksums are enabled without choosing an algorithm
+const DefaultChecksumAlgorithm = "sha256"
+
+// newHash returns the hash for a CHECKSUM_ALGORITHM name
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q, expected sha256, sha512, sha1 or md5", algorithm)
+}
+
+// hashFile returns the hex digest of the file
+func hashFile(path, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksums hashes every file under outputDir and writes checksums.<algorithm> in the format of
+// sha256sum and friends ("<digest>  <relative path>"), so `sha256sum -c` can verify a copy of the dir.
+// It returns the checksum file name and the digest of output.mpd.
+func writeChecksums(outputDir, algorithm string) (name, manifestDigest string, err error) {
+	name = "checksums." + algorithm
+	var lines strings.Builder
+	err = filepath.WalkDir(outputDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == name {
+			return nil
+		}
+		digest, err := hashFile(path, algorithm)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %v", rel, err)
+		}
+		if rel == "output.mpd" {
+			manifestDigest = digest
+		}
+		fmt.Fprintf(&lines, "%s  %s\n", digest, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, name), []byte(lines.String()), 0o644); err != nil {
+		return "", "", fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return name, manifestDigest, nil
+}
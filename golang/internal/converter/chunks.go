@@ -0,0 +1,180 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrChunksMissing is returned when some of the explicitly listed chunks aren't on disk (yet)
+var ErrChunksMissing = errors.New("listed chunks missing")
+
+// chunkManifestFile lists the chunks in merge order when the producer uploads one next to them
+const chunkManifestFile = "manifest.json"
+
+// chunkManifest is the content of manifest.json: {"chunks": ["a.chunk", "b.chunk"]}
+type chunkManifest struct {
+	Chunks []string `json:"chunks"`
+}
+
+// listedChunks returns the explicit chunk order from the task or, failing that, from manifest.json
+// in the task path. ok is false when neither is present.
+func listedChunks(task VideoTask) (names []string, ok bool, err error) {
+	if len(task.Chunks) > 0 {
+		return task.Chunks, true, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(task.Path, chunkManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read chunk manifest: %v", err)
+	}
+
+	var manifest chunkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, false, fmt.Errorf("%w: invalid chunk manifest: %v", ErrInputRejected, err)
+	}
+	for _, name := range manifest.Chunks {
+		if name == "" || strings.ContainsAny(name, `/\`) || name == ".." {
+			return nil, false, fmt.Errorf("%w: invalid chunk name %q in manifest", ErrInputRejected, name)
+		}
+	}
+	return manifest.Chunks, len(manifest.Chunks) > 0, nil
+}
+
+// taskChunks returns the chunk files of the task in merge order. An explicit list (task or manifest.json)
+// is merged strictly in that order and every listed chunk must exist; otherwise the chunk pattern is
+// globbed and sorted by the number in the file name.
+func (vc *VideoConverter) taskChunks(task VideoTask) ([]string, error) {
+	if task.MediaType == MediaTypeImageSequence {
+		frames, _, err := findFrames(task)
+		return frames, err
+	}
+
+	names, ok, err := listedChunks(task)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && len(task.InputDirs) > 0 {
+		return vc.findChunksInDirs(task)
+	}
+	if !ok {
+		return vc.findChunks(task.Path, vc.chunkPattern(task))
+	}
+
+	chunks := make([]string, 0, len(names))
+	var missing []string
+	for _, name := range names {
+		chunk := filepath.Join(task.Path, name)
+		if _, err := os.Stat(chunk); err != nil {
+			missing = append(missing, name)
+			continue
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 {
+		// todos ausentes: mesmo caso do glob vazio (ex.: ja removidos apos a conversao)
+		return nil, fmt.Errorf("%w: none of the %d listed chunks exist in %s", ErrNoChunks, len(names), task.Path)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w in %s: %s", ErrChunksMissing, task.Path, strings.Join(missing, ", "))
+	}
+	return chunks, nil
+}
+
+// findChunksInDirs globs the chunk pattern in every input dir of the task and sorts the chunks by their
+// sequence number across all of them. The same number in two dirs has no defined order, so it's rejected.
+func (vc *VideoConverter) findChunksInDirs(task VideoTask) ([]string, error) {
+	pattern := vc.chunkPattern(task)
+	var chunks []string
+	seen := make(map[int]string)
+	for _, dir := range task.InputDirs {
+		dirChunks, err := filepath.Glob(filepath.Join(task.Path, dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find chunks: %v", err)
+		}
+		for _, chunk := range dirChunks {
+			number := vc.extractNumber(chunk)
+			if other, ok := seen[number]; ok && filepath.Dir(other) != filepath.Dir(chunk) {
+				return nil, fmt.Errorf("%w: chunk sequence %d is in both %s and %s", ErrInputRejected, number, other, chunk)
+			}
+			seen[number] = chunk
+		}
+		chunks = append(chunks, dirChunks...)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: pattern %s in %s (input dirs %s)", ErrNoChunks, pattern, task.Path, strings.Join(task.InputDirs, ", "))
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return vc.extractNumber(chunks[i]) < vc.extractNumber(chunks[j])
+	})
+	return chunks, nil
+}
+
+// validateChunks checks every chunk before merging: empty chunks always fail, and chunks listed in
+// task.ChunkChecksums must match their SHA-256. Bad chunks won't get better on redelivery, so the
+// error wraps ErrInputRejected.
+func (vc *VideoConverter) validateChunks(task VideoTask) error {
+	chunks, err := vc.taskChunks(task)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool, len(chunks))
+	for _, chunk := range chunks {
+		name := filepath.Base(chunk)
+		found[name] = true
+		info, err := os.Stat(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to stat chunk %s: %v", name, err)
+		}
+		if info.Size() == 0 {
+			return fmt.Errorf("%w: chunk %s is empty", ErrInputRejected, name)
+		}
+
+		expected, ok := task.ChunkChecksums[name]
+		if !ok {
+			continue
+		}
+		actual, err := fileChecksum(chunk)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(actual, expected) {
+			return fmt.Errorf("%w: chunk %s checksum mismatch (expected %s, got %s)", ErrInputRejected, name, expected, actual)
+		}
+	}
+
+	// entradas do manifesto sem chunk correspondente indicam upload incompleto
+	for name := range task.ChunkChecksums {
+		if !found[name] {
+			return fmt.Errorf("%w: chunk %s listed in chunk_checksums is missing", ErrInputRejected, name)
+		}
+	}
+	return nil
+}
+
+// fileChecksum returns the hex SHA-256 of the file
+func fileChecksum(path string) (string, error) {
+	input, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open chunk %s: %v", filepath.Base(path), err)
+	}
+	defer input.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, input); err != nil {
+		return "", fmt.Errorf("failed to hash chunk %s: %v", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
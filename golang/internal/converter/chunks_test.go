@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeChunks creates the chunk files in a temporary task path
+func writeChunks(t *testing.T, chunks map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range chunks {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestValidateChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunks    map[string]string
+		checksums map[string]string
+		wantErr   bool
+	}{
+		{
+			name:   "valid chunks",
+			chunks: map[string]string{"1.chunk": "first", "2.chunk": "second"},
+		},
+		{
+			name:    "empty chunk",
+			chunks:  map[string]string{"1.chunk": "first", "2.chunk": ""},
+			wantErr: true,
+		},
+		{
+			name:      "matching checksum",
+			chunks:    map[string]string{"1.chunk": "first", "2.chunk": "second"},
+			checksums: map[string]string{"2.chunk": sha256Hex("second")},
+		},
+		{
+			name:      "checksum mismatch",
+			chunks:    map[string]string{"1.chunk": "first", "2.chunk": "second"},
+			checksums: map[string]string{"2.chunk": sha256Hex("corrupted")},
+			wantErr:   true,
+		},
+		{
+			name:      "checksummed chunk missing",
+			chunks:    map[string]string{"1.chunk": "first"},
+			checksums: map[string]string{"2.chunk": sha256Hex("second")},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vc := &VideoConverter{}
+			task := VideoTask{VideoId: 1, Path: writeChunks(t, tt.chunks), ChunkChecksums: tt.checksums}
+
+			err := vc.validateChunks(task)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			// entradas invalidas vao para a DLQ em vez de serem reprocessadas
+			if !errors.Is(err, ErrInputRejected) {
+				t.Fatalf("got %v, want ErrInputRejected", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrVideoClaimed is returned when another worker holds a live claim on the video. The delivery is requeued
+// after ClaimRetryDelay: the claim may belong to a worker that crashed, whose message is being redelivered.
+var ErrVideoClaimed = errors.New("video claimed by another worker")
+
+// ClaimVideo marks the video as processing so redeliveries to other workers skip it. An existing claim
+// only blocks while it's younger than ttl; older claims belong to crashed workers and are taken over.
+func ClaimVideo(ctx context.Context, db *sql.DB, videoID int, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	query := `INSERT INTO processed_videos (video_id, status, processed_at, claimed_at) VALUES ($1, 'processing', $2, $2)
+		ON CONFLICT (video_id) DO UPDATE SET status = 'processing', claimed_at = EXCLUDED.claimed_at
+		WHERE processed_videos.status <> 'processing' OR processed_videos.claimed_at IS NULL OR processed_videos.claimed_at < $3`
+
+	res, err := db.ExecContext(ctx, query, videoID, now, now.Add(-ttl))
+	if err != nil {
+		return false, dbError(err)
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return claimed > 0, nil
+}
+
+// IsClaimed reports whether the video is being processed under a claim younger than ttl (any claim when
+// ttl is zero)
+func IsClaimed(ctx context.Context, db *sql.DB, videoID int, ttl time.Duration) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM processed_videos WHERE video_id = $1 AND status = 'processing'
+		AND claimed_at >= $2)`
+
+	var cutoff time.Time
+	if ttl > 0 {
+		cutoff = time.Now().Add(-ttl)
+	}
+	var claimed bool
+	if err := db.QueryRowContext(ctx, query, videoID, cutoff).Scan(&claimed); err != nil {
+		return false, dbError(err)
+	}
+	return claimed, nil
+}
+
+// ReclaimStale marks processing claims older than ttl as failed, counting the crashed run as an attempt,
+// and returns how many were released
+func ReclaimStale(ctx context.Context, db *sql.DB, ttl time.Duration) (int64, error) {
+	query := `UPDATE processed_videos SET status = 'failed', claimed_at = NULL, attempts = attempts + 1
+		WHERE status = 'processing' AND claimed_at < $1`
+
+	res, err := db.ExecContext(ctx, query, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,54 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	removeAttempts = 3
+	removeDelay    = 500 * time.Millisecond
+)
+
+// removeWithRetry removes a file, retrying transient failures. A file that is already gone counts as removed.
+func removeWithRetry(path string) error {
+	var err error
+	for attempt := 1; attempt <= removeAttempts; attempt++ {
+		err = os.Remove(path)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if attempt < removeAttempts {
+			time.Sleep(removeDelay * time.Duration(attempt))
+		}
+	}
+	return err
+}
+
+// removeMergedFile deletes the merged file and, when that keeps failing, records it for the janitor
+// instead of leaking it silently
+func (vc *VideoConverter) removeMergedFile(task *VideoTask, mergedFile string) {
+	if err := removeWithRetry(mergedFile); err != nil {
+		slog.Warn("Failed to remove merged file", slog.String("file", mergedFile), slog.String("error", err.Error()))
+		if vc.db == nil {
+			return
+		}
+		ctx, cancel := vc.dbContext(context.Background())
+		defer cancel()
+		if err := RecordPendingCleanup(ctx, vc.db, task.VideoId, mergedFile); err != nil {
+			slog.Error("Failed to record pending cleanup", slog.String("file", mergedFile), slog.String("error", err.Error()))
+		}
+		return
+	}
+	slog.Info("Removed merged file", slog.String("file", mergedFile))
+}
+
+// RecordPendingCleanup registers a file that couldn't be removed so it can be swept later
+func RecordPendingCleanup(ctx context.Context, db *sql.DB, videoID int, path string) error {
+	query := "INSERT INTO pending_cleanups (path, video_id, created_at) VALUES ($1, $2, $3) ON CONFLICT (path) DO NOTHING"
+	_, err := db.ExecContext(ctx, query, path, videoID, time.Now())
+	return dbError(err)
+}
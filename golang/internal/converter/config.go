@@ -0,0 +1,237 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultChunkPattern is the glob used to find uploaded chunks when none is configured
+const DefaultChunkPattern = "*.chunk"
+
+// DASH output layouts
+const (
+	DashLayoutSegmented    = "segmented"
+	DashLayoutSingleFile   = "single_file"
+	DashLayoutPerRendition = "per_rendition"
+)
+
+// Output formats: plain DASH, or CMAF fragments shared by a DASH manifest and an HLS playlist
+const (
+	OutputFormatDASH = "dash"
+	OutputFormatCMAF = "cmaf"
+)
+
+// Features toggles the optional steps of a conversion, so each deployment can enable them independently
+type Features struct {
+	// Subtitles muxes any sidecar .vtt files found in the task path into the DASH manifest
+	Subtitles bool
+	// Previews renders a short animated preview (see PreviewConfig)
+	Previews bool
+	// Thumbnails renders the sprite sheets and thumbnails.vtt scrubber track (see ThumbnailConfig)
+	Thumbnails bool
+	// Cleanup removes merged files and uploaded chunks once they are no longer needed
+	Cleanup bool
+	// HardwareAccel lets ffmpeg decode with -hwaccel (see Config.HardwareAccelType and HardwareDevice)
+	HardwareAccel bool
+	// Checksums writes a checksum file covering every output file, for CDN verification
+	Checksums bool
+	// Loudnorm normalizes the audio loudness (see LoudnormConfig)
+	Loudnorm bool
+	// ProgressiveMP4 also writes a single-quality, faststart output.mp4 for plain downloads
+	ProgressiveMP4 bool
+	// Quarantine moves the inputs of permanently failed videos to Config.QuarantineDir
+	Quarantine bool
+	// BurnSubtitles draws a sidecar .srt/.vtt into the video frames (see Config.SubtitleStyle) instead of
+	// muxing a subtitle track; tasks can also ask for it with burn_subtitles
+	BurnSubtitles bool
+}
+
+// Config holds the optional behaviour of the VideoConverter, loaded once at startup
+type Config struct {
+	Features Features
+	// QuarantineDir receives the chunks and merged file of dead-lettered videos, one directory per video_id
+	QuarantineDir string
+	// WorkDir is a fast local directory for merges and intermediate files; empty means the task path
+	WorkDir string
+	// EnableEncryption encrypts the DASH output using EncryptionScheme (e.g. cenc-aes-ctr)
+	EnableEncryption bool
+	EncryptionScheme string
+	// KeyServerURL is queried with ?video_id=N when a task doesn't carry its own key
+	KeyServerURL string
+	// MaxErrorOutputBytes caps how much ffmpeg output is stored in the error log
+	MaxErrorOutputBytes int
+	// MaxDurationSeconds and MaxInputBytes reject oversized inputs before encoding; zero disables them
+	MaxDurationSeconds int
+	MaxInputBytes      int64
+	// MaxMergedBytes aborts the chunk merge once the merged file grows past it; zero disables it
+	MaxMergedBytes int64
+	// Profiles maps the names tasks may reference to their renditions, loaded from PROFILES_FILE
+	Profiles map[string]Profile
+	// ChunkPattern is the glob matching uploaded chunk files inside the task path
+	ChunkPattern string
+	// ConversionTimeout bounds a single conversion; keep it below the broker's consumer_timeout. Zero disables it
+	ConversionTimeout time.Duration
+	// DashLayout chooses between many segment files (segmented), one byte-range file per stream (single_file)
+	// and segments in one directory per representation under a master output.mpd (per_rendition)
+	DashLayout string
+	// OutputSubdir is a text/template for the DASH output directory (see OutputFields), relative to the task
+	// path or absolute inside MediaRoot
+	OutputSubdir string
+	// MediaRoot is the directory that holds every task path
+	MediaRoot string
+	// JanitorInterval enables the background sweep of stale artifacts older than JanitorMaxAge; zero disables it
+	JanitorInterval time.Duration
+	JanitorMaxAge   time.Duration
+	// MaxAttempts dead-letters a video after this many failed conversions; zero retries forever
+	MaxAttempts int
+	// Preview generates a short animated preview in the task path
+	Preview PreviewConfig
+	// Loudnorm sets the loudness target when Features.Loudnorm is enabled
+	Loudnorm LoudnormConfig
+	// SubtitleStyle styles burned-in subtitles
+	SubtitleStyle SubtitleStyle
+	// Thumbnails generates the scrubber sprite sheets and thumbnails.vtt in the output dir
+	Thumbnails ThumbnailConfig
+	// ErrorExchange receives a FailureEvent for every permanently failed video; empty disables it
+	ErrorExchange string
+	ErrorKey      string
+	ErrorQueue    string
+	// ConfirmationRetryInterval is how often stored confirmations are re-emitted; zero disables the sweeper
+	ConfirmationRetryInterval time.Duration
+	// AutoAck must match the consumer's auto-ack mode. With auto-ack (at-most-once) the broker forgets a message as
+	// soon as it's delivered: no redelivery storms, but a crash or failure loses the video and nothing is dead-lettered.
+	AutoAck bool
+	// StrictAck acks a conversion message only after the video is marked processed and its confirmation is
+	// stored in the same transaction and published (broker-confirmed with RabbitMQ publisher confirms).
+	// Stored confirmations that weren't published are re-emitted at startup and by the sweeper.
+	StrictAck bool
+	// FFmpegLogToFile writes the full ffmpeg output of each video to ffmpeg.log in its task path
+	FFmpegLogToFile bool
+	// ConfirmationRate caps confirmation publishes per second (0 disables the limit), allowing bursts of ConfirmationBurst
+	ConfirmationRate  float64
+	ConfirmationBurst int
+	// DBTimeout bounds each database call; timeouts requeue the message. 0 disables the limit
+	DBTimeout time.Duration
+	// DBRetryAttempts retries transient database errors (lost connections, deadlocks) in the idempotency
+	// checks, waiting DBRetryBackoff and doubling it between attempts; 1 disables retries
+	DBRetryAttempts int
+	DBRetryBackoff  time.Duration
+	// DedupCacheSize keeps up to this many recently processed video_ids in memory for DedupCacheTTL, so
+	// duplicate deliveries skip the IsProcessed query; 0 disables the cache
+	DedupCacheSize int
+	DedupCacheTTL  time.Duration
+	// VerifySegments decodes this many segments of the output before marking success; 0 skips the check,
+	// and so does encryption, since the segments only decode with the key
+	VerifySegments int
+	// ConfirmationPublisher delivers confirmations instead of RabbitMQ when set, e.g. to Kafka
+	ConfirmationPublisher ConfirmationPublisher
+	// PostProcessors run in order after a successful encode; any failure fails the conversion
+	PostProcessors []PostProcessor
+	// ClaimTTL is how long a processing claim blocks other workers before it's considered stale; 0 disables claims
+	ClaimTTL time.Duration
+	// ClaimRetryDelay is how long a delivery for a video claimed by another worker waits before it's requeued
+	ClaimRetryDelay time.Duration
+	// OutputFormat is the default for tasks without output_format (dash or cmaf)
+	OutputFormat string
+	// MergeStrategy is the default for tasks without merge_strategy: bytes concatenates the chunk files,
+	// concat remuxes them with ffmpeg's concat demuxer
+	MergeStrategy string
+	// ChunkSettleTime waits until the chunks stop changing for this long before hashing and merging them,
+	// for at most ChunkSettleMax; 0 disables the wait
+	ChunkSettleTime time.Duration
+	ChunkSettleMax  time.Duration
+	// HardwareAccelType is the -hwaccel API (auto, cuda, vaapi, qsv...) and HardwareDevice the GPU index or
+	// device path passed as -hwaccel_device; both only apply with Features.HardwareAccel
+	HardwareAccelType string
+	HardwareDevice    string
+	// ImageSequenceFramerate is the default framerate for image_sequence tasks without their own
+	ImageSequenceFramerate float64
+	// ValidateChunks rejects empty chunks before merging (checksums in the task are always verified)
+	ValidateChunks bool
+	// TwoPass enables two-pass encoding for every task; profiles can also enable it individually
+	TwoPass bool
+	// AutoLadder derives the renditions from the source resolution when the task has no profile
+	AutoLadder bool
+	// S3Endpoint resolves s3://bucket/key sources to <endpoint>/bucket/key
+	S3Endpoint string
+	// ProgressiveHeight scales output.mp4 to this height; 0 keeps the source resolution
+	ProgressiveHeight int
+	// BreakerThreshold pauses consumption after this many consecutive failed conversions, retrying one
+	// delivery every BreakerCooldown until a conversion succeeds; 0 disables the circuit breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// ChecksumAlgorithm is sha256 (default), sha512, sha1 or md5
+	ChecksumAlgorithm string
+	// AllowedExtraArgs lists the ffmpeg flags tasks may pass in extra_args; empty rejects any extra_args
+	AllowedExtraArgs []string
+	// WorkerID identifies this instance in the video_events history
+	WorkerID string
+	// Workers caps the conversions running at once, from the queue and RunTask (e.g. gRPC) alike; 0 means no cap
+	Workers int
+}
+
+// Validate checks the settings that can't be fixed with a default
+func (c Config) Validate() error {
+	switch c.DashLayout {
+	case "", DashLayoutSegmented, DashLayoutSingleFile, DashLayoutPerRendition:
+	default:
+		return fmt.Errorf("invalid DASH layout %q, expected %s, %s or %s", c.DashLayout, DashLayoutSegmented, DashLayoutSingleFile, DashLayoutPerRendition)
+	}
+	// executado com valores de exemplo para pegar campos inexistentes ja na subida
+	tmpl, err := parseOutputTemplate(c.OutputSubdir)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, OutputFields{VideoID: 1, Date: "2006-01-02", Path: "/media/uploads/1"})
+	}
+	if err != nil {
+		return fmt.Errorf("invalid output template %q: %v", c.OutputSubdir, err)
+	}
+	if !validMergeStrategy(c.MergeStrategy) {
+		return fmt.Errorf("invalid merge strategy %q, expected %s or %s", c.MergeStrategy, MergeStrategyBytes, MergeStrategyConcat)
+	}
+	if c.Features.Quarantine && c.QuarantineDir == "" {
+		return fmt.Errorf("quarantine is enabled but no quarantine dir is set")
+	}
+	if c.StrictAck && c.AutoAck {
+		return fmt.Errorf("strict ack can't be combined with auto-ack")
+	}
+	if c.ImageSequenceFramerate < 0 {
+		return fmt.Errorf("image sequence framerate must not be negative, got %g", c.ImageSequenceFramerate)
+	}
+	if !validOutputFormat(c.OutputFormat) {
+		return fmt.Errorf("invalid output format %q, expected %s or %s", c.OutputFormat, OutputFormatDASH, OutputFormatCMAF)
+	}
+	if c.Features.Thumbnails {
+		if c.Thumbnails.Interval <= 0 || c.Thumbnails.Width <= 0 || c.Thumbnails.Columns <= 0 || c.Thumbnails.Rows <= 0 {
+			return fmt.Errorf("thumbnail interval, width, columns and rows must be greater than zero")
+		}
+	}
+	// o mp4 progressivo sairia sem criptografia, expondo o conteudo protegido
+	if c.Features.ProgressiveMP4 && c.EnableEncryption {
+		return fmt.Errorf("progressive MP4 output can't be combined with encryption")
+	}
+	if c.Features.Checksums && c.ChecksumAlgorithm != "" {
+		if _, err := newHash(c.ChecksumAlgorithm); err != nil {
+			return err
+		}
+	}
+	if c.Features.Loudnorm && (c.Loudnorm.TargetLUFS < -70 || c.Loudnorm.TargetLUFS > -5) {
+		return fmt.Errorf("loudnorm target %g LUFS is out of range, expected -70 to -5", c.Loudnorm.TargetLUFS)
+	}
+	if err := c.SubtitleStyle.validate(); err != nil {
+		return err
+	}
+	if c.Features.Previews {
+		if c.Preview.Format != PreviewFormatGIF && c.Preview.Format != PreviewFormatMP4 {
+			return fmt.Errorf("invalid preview format %q, expected %s or %s", c.Preview.Format, PreviewFormatGIF, PreviewFormatMP4)
+		}
+		if c.Preview.Seconds <= 0 || c.Preview.FPS <= 0 || c.Preview.Width <= 0 {
+			return fmt.Errorf("preview duration, fps and width must be greater than zero")
+		}
+	}
+	return nil
+}
+
+func validOutputFormat(format string) bool {
+	return format == "" || format == OutputFormatDASH || format == OutputFormatCMAF
+}
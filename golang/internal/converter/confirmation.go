@@ -0,0 +1,276 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	confirmationAttempts = 3
+	confirmationDelay    = time.Second
+	// confirmationSweeperLock is the advisory lock key held during a sweeper pass
+	confirmationSweeperLock = 7291002
+)
+
+// PendingConfirmation is a confirmation that couldn't be published and waits to be re-emitted
+type PendingConfirmation struct {
+	VideoId    int
+	Exchange   string
+	RoutingKey string
+	Queue      string
+	Payload    []byte
+	// CorrelationId is the correlation_id property of the task delivery, carried over to the confirmation
+	CorrelationId string
+	// Headers are set on the published message; empty publishes without headers
+	Headers map[string]string
+}
+
+// propagatedHeaders are copied from the task delivery onto its confirmation
+var propagatedHeaders = []string{"traceparent", "tracestate", "x-request-id", "origin"}
+
+// confirmationHeaders collects the trace context of the delivery, so downstream consumers can follow a
+// video through the pipeline and filter by header
+func confirmationHeaders(d amqp.Delivery) map[string]string {
+	headers := map[string]string{}
+	for _, name := range propagatedHeaders {
+		if value, ok := d.Headers[name].(string); ok && value != "" {
+			headers[name] = value
+		}
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// ConfirmationPublisher delivers confirmation messages. The default publishes to RabbitMQ through the
+// converter's Publisher; Config.ConfirmationPublisher replaces it, e.g. with Kafka.
+type ConfirmationPublisher interface {
+	PublishConfirmation(ctx context.Context, confirmation PendingConfirmation) error
+}
+
+// rabbitConfirmations publishes confirmations to their exchange and routing key
+type rabbitConfirmations struct {
+	publisher Publisher
+}
+
+// PublishConfirmation publishes the confirmation, with its correlation id and headers when it carries any
+func (r rabbitConfirmations) PublishConfirmation(ctx context.Context, pending PendingConfirmation) error {
+	if len(pending.Headers) == 0 && pending.CorrelationId == "" {
+		return r.publisher.PublishMessage(pending.Exchange, pending.RoutingKey, pending.Queue, pending.Payload)
+	}
+
+	var headers amqp.Table
+	if len(pending.Headers) > 0 {
+		headers = make(amqp.Table, len(pending.Headers))
+		for name, value := range pending.Headers {
+			headers[name] = value
+		}
+	}
+	return r.publisher.PublishMessageWithProperties(pending.Exchange, pending.RoutingKey, pending.Queue, pending.Payload, pending.CorrelationId, headers)
+}
+
+// publishPending publishes the confirmation with the configured confirmation publisher
+func (vc *VideoConverter) publishPending(ctx context.Context, pending PendingConfirmation) error {
+	return vc.confirmations.PublishConfirmation(ctx, pending)
+}
+
+// publishWithRetry publishes the confirmation, retrying a few times; when every attempt fails the
+// message is stored in pending_confirmations so the sweeper can re-emit it later. Publishes wait for the
+// confirmation rate limiter; a canceled wait also stores the message instead of dropping it.
+func (vc *VideoConverter) publishWithRetry(ctx context.Context, pending PendingConfirmation) error {
+	var err error
+	for attempt := 1; attempt <= confirmationAttempts; attempt++ {
+		if err = vc.confirmationLimiter.Wait(ctx); err != nil {
+			break
+		}
+		err = vc.publishPending(ctx, pending)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("Failed to publish confirmation",
+			slog.Int("video_id", pending.VideoId),
+			slog.Int("attempt", attempt),
+			slog.String("error", err.Error()))
+		if attempt < confirmationAttempts {
+			time.Sleep(confirmationDelay * time.Duration(attempt))
+		}
+	}
+
+	dbCtx, cancel := vc.dbContext(ctx)
+	defer cancel()
+	if dbErr := RecordPendingConfirmation(dbCtx, vc.db, pending); dbErr != nil {
+		slog.Error("Failed to record pending confirmation", slog.Int("video_id", pending.VideoId), slog.String("error", dbErr.Error()))
+		return err
+	}
+	slog.Warn("Confirmation stored for later delivery", slog.Int("video_id", pending.VideoId))
+	return err
+}
+
+// StartConfirmationSweeper periodically re-emits stored confirmations until ctx is canceled.
+// It's a no-op unless ConfirmationRetryInterval is set.
+func (vc *VideoConverter) StartConfirmationSweeper(ctx context.Context) {
+	if vc.cfg.ConfirmationRetryInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(vc.cfg.ConfirmationRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			vc.resendPendingConfirmations(ctx)
+		}
+	}
+}
+
+// resendPendingConfirmations publishes every stored confirmation, removing the ones that went through.
+// Workers share the table, so a pass only runs in the worker holding the sweeper's advisory lock; the
+// others skip it instead of publishing the same confirmations again.
+func (vc *VideoConverter) resendPendingConfirmations(ctx context.Context) {
+	lockCtx, cancelLock := vc.dbContext(ctx)
+	unlock, ok, err := tryAdvisoryLock(lockCtx, vc.db, confirmationSweeperLock)
+	cancelLock()
+	if err != nil {
+		slog.Warn("Failed to take the confirmation sweeper lock", slog.String("error", err.Error()))
+		return
+	}
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	dbCtx, cancel := vc.dbContext(ctx)
+	pending, err := ListPendingConfirmations(dbCtx, vc.db)
+	cancel()
+	if err != nil {
+		slog.Warn("Failed to list pending confirmations", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, confirmation := range pending {
+		if err := vc.confirmationLimiter.Wait(ctx); err != nil {
+			return
+		}
+		err := vc.publishPending(ctx, confirmation)
+		if err != nil {
+			slog.Warn("Failed to re-emit confirmation", slog.Int("video_id", confirmation.VideoId), slog.String("error", err.Error()))
+			continue
+		}
+		dbCtx, cancel := vc.dbContext(ctx)
+		err = DeletePendingConfirmation(dbCtx, vc.db, confirmation)
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to clear pending confirmation", slog.Int("video_id", confirmation.VideoId), slog.String("error", err.Error()))
+			continue
+		}
+		slog.Info("Re-emitted confirmation", slog.Int("video_id", confirmation.VideoId))
+	}
+}
+
+// RecordPendingConfirmation stores a confirmation that still needs to be published
+func RecordPendingConfirmation(ctx context.Context, db *sql.DB, pending PendingConfirmation) error {
+	return recordPendingConfirmation(ctx, db, pending)
+}
+
+func recordPendingConfirmation(ctx context.Context, db dbExecer, pending PendingConfirmation) error {
+	headers, _ := json.Marshal(pending.Headers)
+	query := `INSERT INTO pending_confirmations (video_id, exchange, routing_key, queue, payload, headers, correlation_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (video_id) DO UPDATE SET exchange = EXCLUDED.exchange, routing_key = EXCLUDED.routing_key,
+			queue = EXCLUDED.queue, payload = EXCLUDED.payload, headers = EXCLUDED.headers,
+			correlation_id = EXCLUDED.correlation_id, created_at = EXCLUDED.created_at`
+	_, err := db.ExecContext(ctx, query, pending.VideoId, pending.Exchange, pending.RoutingKey, pending.Queue, pending.Payload, headers,
+		pending.CorrelationId, time.Now())
+	return err
+}
+
+// markProcessedWithConfirmation marks the video as processed and stores its confirmation in the same
+// transaction, so a crash can't leave a converted video whose confirmation is lost
+func markProcessedWithConfirmation(ctx context.Context, db *sql.DB, videoID int, contentHash string, result *ConversionResult, pending PendingConfirmation) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	if err := markProcessed(ctx, tx, videoID, contentHash, result); err != nil {
+		return err
+	}
+	if err := recordPendingConfirmation(ctx, tx, pending); err != nil {
+		return dbError(fmt.Errorf("failed to store confirmation: %w", err))
+	}
+	return dbError(tx.Commit())
+}
+
+// deliverStoredConfirmation publishes a confirmation already stored by markProcessedWithConfirmation and
+// removes it once the broker has it. A failed publish stays stored for the sweeper or the next startup.
+func (vc *VideoConverter) deliverStoredConfirmation(ctx context.Context, pending PendingConfirmation) {
+	if err := vc.confirmationLimiter.Wait(ctx); err != nil {
+		return
+	}
+	if err := vc.publishPending(ctx, pending); err != nil {
+		slog.Warn("Confirmation stored for later delivery", slog.Int("video_id", pending.VideoId), slog.String("error", err.Error()))
+		return
+	}
+	dbCtx, cancel := vc.dbContext(ctx)
+	defer cancel()
+	if err := DeletePendingConfirmation(dbCtx, vc.db, pending); err != nil {
+		// fica armazenada e sera reenviada: duplicata em vez de perda
+		slog.Warn("Failed to clear pending confirmation", slog.Int("video_id", pending.VideoId), slog.String("error", err.Error()))
+	}
+}
+
+// RecoverPendingConfirmations re-emits the confirmations a previous run stored but didn't publish, e.g.
+// because it crashed between committing a conversion and acking its message
+func (vc *VideoConverter) RecoverPendingConfirmations(ctx context.Context) {
+	vc.resendPendingConfirmations(ctx)
+}
+
+// ListPendingConfirmations returns the confirmations waiting to be re-emitted, oldest first. A row with
+// undecodable headers is returned without them, so it doesn't hold back every other confirmation.
+func ListPendingConfirmations(ctx context.Context, db *sql.DB) ([]PendingConfirmation, error) {
+	rows, err := db.QueryContext(ctx, `SELECT video_id, exchange, routing_key, queue, payload, headers, COALESCE(correlation_id, '')
+		FROM pending_confirmations ORDER BY created_at`)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var pending []PendingConfirmation
+	for rows.Next() {
+		var confirmation PendingConfirmation
+		var headers []byte
+		if err := rows.Scan(&confirmation.VideoId, &confirmation.Exchange, &confirmation.RoutingKey, &confirmation.Queue, &confirmation.Payload,
+			&headers, &confirmation.CorrelationId); err != nil {
+			return nil, err
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &confirmation.Headers); err != nil {
+				slog.Warn("Invalid headers in pending confirmation, re-emitting without them",
+					slog.Int("video_id", confirmation.VideoId), slog.String("error", err.Error()))
+				confirmation.Headers = nil
+			}
+		}
+		pending = append(pending, confirmation)
+	}
+	return pending, rows.Err()
+}
+
+// DeletePendingConfirmation removes a confirmation once it was published
+func DeletePendingConfirmation(ctx context.Context, db *sql.DB, published PendingConfirmation) error {
+	// o payload identifica a confirmacao publicada: uma mais nova do mesmo video (re-upload) gravada
+	// nesse meio tempo continua pendente
+	_, err := db.ExecContext(ctx, "DELETE FROM pending_confirmations WHERE video_id = $1 AND payload = $2::jsonb",
+		published.VideoId, string(published.Payload))
+	return dbError(err)
+}
@@ -0,0 +1,90 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+// fakePublisher records the messages published through it
+type fakePublisher struct {
+	published []publishedMessage
+}
+
+type publishedMessage struct {
+	exchange, routingKey, queue string
+	body                        []byte
+	correlationID               string
+	headers                     amqp.Table
+}
+
+func (p *fakePublisher) PublishMessage(exchange, routingKey, queueName string, message []byte) error {
+	p.published = append(p.published, publishedMessage{exchange, routingKey, queueName, message, "", nil})
+	return nil
+}
+
+func (p *fakePublisher) PublishMessageWithProperties(exchange, routingKey, queueName string, message []byte, correlationID string, headers amqp.Table) error {
+	p.published = append(p.published, publishedMessage{exchange, routingKey, queueName, message, correlationID, headers})
+	return nil
+}
+
+func TestPublishConfirmationPayload(t *testing.T) {
+	publisher := &fakePublisher{}
+	vc := NewVideoConverter(publisher, nil, nil, Config{})
+
+	task := VideoTask{VideoId: 7, Path: "/media/uploads/7"}
+	result := &ConversionResult{
+		OutputPath:   "/media/uploads/7/mpeg-dash",
+		ManifestPath: "/media/uploads/7/mpeg-dash/output.mpd",
+		Size:         1024,
+		Duration:     12.5,
+		Renditions:   []string{"720p", "480p"},
+		DashLayout:   DashLayoutSegmented,
+		Manifests:    map[string]string{"dash": "/media/uploads/7/mpeg-dash/output.mpd"},
+	}
+	err := vc.publishConfirmation(context.Background(), task, result, "req-7", nil, "conversion_exchange", "finish-conversion", "finish_confirmation_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(publisher.published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(publisher.published))
+	}
+	msg := publisher.published[0]
+	if msg.exchange != "conversion_exchange" || msg.routingKey != "finish-conversion" || msg.queue != "finish_confirmation_queue" {
+		t.Errorf("published to %s/%s/%s", msg.exchange, msg.routingKey, msg.queue)
+	}
+	if msg.correlationID != "req-7" || msg.headers != nil {
+		t.Errorf("correlation id %q, headers %v", msg.correlationID, msg.headers)
+	}
+
+	var confirmation ConfirmationMessage
+	if err := json.Unmarshal(msg.body, &confirmation); err != nil {
+		t.Fatalf("payload is not a confirmation: %v", err)
+	}
+	if confirmation.VideoId != 7 || confirmation.Path != task.Path || confirmation.ManifestPath != result.ManifestPath ||
+		confirmation.Size != 1024 || confirmation.Duration != 12.5 || len(confirmation.Renditions) != 2 ||
+		confirmation.Manifests["dash"] != result.ManifestPath {
+		t.Errorf("unexpected confirmation %+v", confirmation)
+	}
+}
+
+func TestPublishFailurePayload(t *testing.T) {
+	publisher := &fakePublisher{}
+	vc := NewVideoConverter(publisher, nil, nil, Config{ErrorExchange: "conversion_exchange", ErrorKey: "conversion-failed", ErrorQueue: "video_error_queue"})
+
+	vc.publishFailure(VideoTask{VideoId: 3, Path: "/media/uploads/3"}, "Invalid task", ErrInputRejected)
+
+	if len(publisher.published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(publisher.published))
+	}
+	var event FailureEvent
+	if err := json.Unmarshal(publisher.published[0].body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.VideoId != 3 || event.Error != "Invalid task" || event.Kind != "input_rejected" {
+		t.Errorf("unexpected failure event %+v", event)
+	}
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrDBTimeout marks database calls that hit Config.DBTimeout; the message is requeued instead of dropped
+var ErrDBTimeout = errors.New("database operation timed out")
+
+// dbContext bounds a database call by DBTimeout. It doesn't inherit ctx's cancellation, so failures
+// can still be recorded after the conversion itself was canceled or timed out.
+func (vc *VideoConverter) dbContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithoutCancel(ctx)
+	if vc.cfg.DBTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, vc.cfg.DBTimeout)
+}
+
+// tryAdvisoryLock takes the Postgres advisory lock key without waiting, so only one worker runs a periodic
+// job at a time. The lock lives in its session: unlock releases it and returns the connection to the pool.
+func tryAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (unlock func(), ok bool, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		conn.Close()
+	}, true, nil
+}
+
+// dbError classifies deadline errors as ErrDBTimeout
+func dbError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrDBTimeout, err)
+	}
+	return err
+}
+
+// isTransientDBError reports whether err is a connection problem or a conflict that may succeed if the
+// same statement is simply run again. Constraint violations, syntax errors and the like are permanent.
+func isTransientDBError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08": // connection_exception
+			return true
+		case pqErr.Code == "40001", pqErr.Code == "40P01": // serialization_failure, deadlock_detected
+			return true
+		case pqErr.Code == "53300", pqErr.Code == "57P01", pqErr.Code == "57P03": // too_many_connections, admin_shutdown, cannot_connect_now
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryDB runs fn up to DBRetryAttempts times, backing off from DBRetryBackoff between attempts, as long as
+// it fails with a transient error. Waiting stops early when ctx ends.
+func (vc *VideoConverter) retryDB(ctx context.Context, operation string, fn func() error) error {
+	attempts := max(vc.cfg.DBRetryAttempts, 1)
+	backoff := vc.cfg.DBRetryBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= attempts || !isTransientDBError(err) {
+			return err
+		}
+		slog.Warn("Transient database error, retrying", slog.String("operation", operation),
+			slog.Int("attempt", attempt), slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
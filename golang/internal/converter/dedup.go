@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// dedupCache remembers recently processed videos so duplicate deliveries skip the IsProcessed query.
+// It only ever answers "processed"; misses and expired entries fall through to the database, which
+// stays the source of truth. Least recently used entries are evicted beyond size.
+type dedupCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is the most recently used
+	entries map[int]*list.Element
+}
+
+type dedupEntry struct {
+	videoID     int
+	contentHash string
+	expires     time.Time
+}
+
+// newDedupCache returns nil (no caching) when size or ttl is not positive
+func newDedupCache(size int, ttl time.Duration) *dedupCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &dedupCache{size: size, ttl: ttl, order: list.New(), entries: make(map[int]*list.Element)}
+}
+
+// processed reports whether the video was recently seen processed from the same content; an empty
+// contentHash matches on video_id alone, like IsProcessed. A nil cache always misses.
+func (c *dedupCache) processed(videoID int, contentHash string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[videoID]
+	if !ok {
+		return false
+	}
+	entry := element.Value.(*dedupEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, videoID)
+		return false
+	}
+	if contentHash != "" && contentHash != entry.contentHash {
+		return false
+	}
+	c.order.MoveToFront(element)
+	return true
+}
+
+// add records the video as processed from contentHash
+func (c *dedupCache) add(videoID int, contentHash string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &dedupEntry{videoID: videoID, contentHash: contentHash, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[videoID]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[videoID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupEntry).videoID)
+	}
+}
+
+// forget drops the video, e.g. when it's forcibly reprocessed and may end up failed
+func (c *dedupCache) forget(videoID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[videoID]; ok {
+		c.order.Remove(element)
+		delete(c.entries, videoID)
+	}
+}
@@ -0,0 +1,393 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EncodeOptions carries the per-task settings an Encoder needs besides the input and output paths
+type EncodeOptions struct {
+	// Subtitles lists sidecar .vtt files to add as text adaptation sets
+	Subtitles []string
+	// BurnSubtitles is a .srt or .vtt drawn into every video rendition, styled by SubtitleStyle;
+	// it's never combined with Subtitles
+	BurnSubtitles string
+	SubtitleStyle SubtitleStyle
+	// Renditions encodes one video representation per entry; empty keeps ffmpeg's defaults
+	Renditions   []Rendition
+	AudioBitrate string
+	// AudioTracks replaces the input's own audio with one labeled adaptation set per language
+	AudioTracks []AudioTrack
+	// Encryption, when set, encrypts segments with the given scheme and key
+	Encryption       *EncryptionKey
+	EncryptionScheme string
+	// SingleFile writes one .m4s per stream addressed by byte ranges instead of many segments
+	SingleFile bool
+	// PerRendition writes the segments of each representation to its own stream<id> directory
+	PerRendition bool
+	// HLSPlaylist writes CMAF (fragmented MP4) segments and an HLS master.m3u8 next to output.mpd
+	HLSPlaylist bool
+	// HardwareAccel decodes the input with -hwaccel HardwareAccelType (auto by default, which falls back to
+	// software when unavailable), on HardwareDevice when set
+	HardwareAccel     bool
+	HardwareAccelType string
+	HardwareDevice    string
+	// LogFile, when set, receives the full ffmpeg output
+	LogFile string
+	// PassLogFile enables two-pass encoding: a first analysis pass writes its stats under this prefix,
+	// which must be unique per video, and the files are removed after the second pass
+	PassLogFile string
+	// Loudnorm, when set, normalizes every audio stream of the output; inputs must have audio
+	Loudnorm *LoudnormConfig
+	// loudness holds the two-pass measurements of each audio source, filled in by Encode
+	loudness []*loudnessMeasurement
+	// Threads and FilterThreads are set by the encoder from FFmpegConfig
+	Threads       int
+	FilterThreads int
+	// ExtraArgs are appended just before the output, after every generated option
+	ExtraArgs []string
+	// Start and Duration (seconds) limit the encode to a clip of the input; zero Duration reads to the end
+	Start    float64
+	Duration float64
+}
+
+// Encoder converts a merged input file into MPEG-DASH output inside outputDir
+type Encoder interface {
+	Encode(ctx context.Context, input, outputDir string, opts EncodeOptions) error
+}
+
+// FFmpegError is returned when ffmpeg exits with an error, keeping the command line and its full output
+type FFmpegError struct {
+	// Op describes the ffmpeg step that failed; empty means the DASH conversion itself
+	Op      string
+	Args    []string
+	Output  string
+	LogFile string
+	Err     error
+}
+
+func (e *FFmpegError) Error() string {
+	if e.Op != "" {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("failed to convert to MPEG-DASH: %v", e.Err)
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes every FFmpegError match ErrFFmpegFailed, ErrDiskFull when ffmpeg ran out of space and
+// ErrDeviceUnavailable when the hardware device couldn't be used
+func (e *FFmpegError) Is(target error) bool {
+	switch target {
+	case ErrFFmpegFailed:
+		return true
+	case ErrDiskFull:
+		return strings.Contains(e.Output, "No space left on device")
+	case ErrDeviceUnavailable:
+		return isDeviceError(e.Output)
+	}
+	return false
+}
+
+// CommandLine returns the ffmpeg invocation as a single string, with the encryption key redacted
+func (e *FFmpegError) CommandLine() string {
+	return ffmpegBinary + " " + redactArgs(e.Args)
+}
+
+// encryptionKeyOption matches the CENC key passed to the muxer in -format_options
+var encryptionKeyOption = regexp.MustCompile(`encryption_key=[^:]*`)
+
+// redactArgs joins ffmpeg arguments for logs and error records, hiding the encryption key
+func redactArgs(args []string) string {
+	return encryptionKeyOption.ReplaceAllString(strings.Join(args, " "), "encryption_key=REDACTED")
+}
+
+// FFmpegConfig holds the settings shared by every ffmpeg invocation
+type FFmpegConfig struct {
+	// LogLevel is passed as -loglevel (quiet, error, warning, info, verbose, debug)
+	LogLevel string
+	// Threads and FilterThreads cap the encoder and filter graph threads of each job, so concurrent
+	// workers don't each spawn one thread per core; 0 lets ffmpeg decide
+	Threads       int
+	FilterThreads int
+}
+
+// FFmpegEncoder encodes by shelling out to the ffmpeg binary
+type FFmpegEncoder struct {
+	cfg FFmpegConfig
+}
+
+func NewFFmpegEncoder(cfg FFmpegConfig) *FFmpegEncoder {
+	return &FFmpegEncoder{cfg: cfg}
+}
+
+// Encode runs ffmpeg to produce output.mpd and its segments in outputDir
+func (e *FFmpegEncoder) Encode(ctx context.Context, input, outputDir string, opts EncodeOptions) error {
+	opts.Threads, opts.FilterThreads = e.cfg.Threads, e.cfg.FilterThreads
+	if opts.PassLogFile != "" {
+		defer removePassLogs(opts.PassLogFile)
+		if err := e.run(ctx, buildFirstPassArgs(input, opts), opts.LogFile); err != nil {
+			return err
+		}
+	}
+	if opts.Loudnorm != nil && opts.Loudnorm.TwoPass {
+		// primeira passada do loudnorm: mede cada fonte de audio antes do encode
+		for _, source := range audioSources(opts) {
+			output, err := e.exec(ctx, buildLoudnessArgs(input, source, opts), opts.LogFile)
+			if err != nil {
+				return err
+			}
+			measured, err := parseLoudness(output)
+			if err != nil {
+				return fmt.Errorf("failed to measure loudness of %s: %w", source, err)
+			}
+			opts.loudness = append(opts.loudness, measured)
+		}
+	}
+	if opts.PerRendition {
+		cleanup, err := prepareRenditionDirs(outputDir, opts)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+	return e.run(ctx, buildArgs(input, outputDir, opts), opts.LogFile)
+}
+
+// run executes one ffmpeg invocation at the configured log level, logging its output to logFile when set
+func (e *FFmpegEncoder) run(ctx context.Context, args []string, logFile string) error {
+	if e.cfg.LogLevel != "" {
+		args = append([]string{"-hide_banner", "-loglevel", e.cfg.LogLevel}, args...)
+	}
+	_, err := e.exec(ctx, args, logFile)
+	return err
+}
+
+// exec runs ffmpeg with args as given and returns its combined output
+func (e *FFmpegEncoder) exec(ctx context.Context, args []string, logFile string) ([]byte, error) {
+	ffmpegCmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	output, err := ffmpegCmd.CombinedOutput()
+	if logFile != "" {
+		writeLogFile(logFile, args, output)
+	}
+	if err != nil {
+		return output, &FFmpegError{Args: args, Output: string(output), LogFile: logFile, Err: err}
+	}
+	return output, nil
+}
+
+// removePassLogs deletes the stats files of a two-pass encode (<prefix>-N.log and .mbtree)
+func removePassLogs(prefix string) {
+	files, _ := filepath.Glob(prefix + "*")
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			slog.Warn("Failed to remove pass log", slog.String("file", file), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// writeLogFile appends the command and its full output to the per-video ffmpeg log
+func writeLogFile(path string, args []string, output []byte) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		slog.Warn("Failed to open ffmpeg log file", slog.String("file", path), slog.String("error", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "# %s %s %s\n", time.Now().Format(time.RFC3339), ffmpegBinary, redactArgs(args))
+	file.Write(output)
+}
+
+// inputArgs lists the merged file followed by the sidecar audio and subtitle inputs
+func inputArgs(input string, opts EncodeOptions) []string {
+	var args []string
+	if opts.FilterThreads > 0 {
+		args = append(args, "-filter_threads", strconv.Itoa(opts.FilterThreads))
+	}
+	args = append(args, hwaccelArgs(opts)...)
+	// -ss/-t antes de cada -i: todas as entradas recortadas no mesmo trecho
+	clip := clipArgs(opts)
+	args = append(args, clip...)
+	args = append(args, "-i", input) // Arquivo de entrada
+
+	// Trilhas de audio separadas por idioma
+	for _, track := range opts.AudioTracks {
+		args = append(args, clip...)
+		args = append(args, "-i", track.File)
+	}
+
+	// Legendas opcionais (.vtt) enviadas junto com os chunks
+	for _, subtitle := range opts.Subtitles {
+		args = append(args, clip...)
+		args = append(args, "-i", subtitle)
+	}
+	return args
+}
+
+// threadArgs limits the encoder threads of the output
+func threadArgs(opts EncodeOptions) []string {
+	if opts.Threads <= 0 {
+		return nil
+	}
+	return []string{"-threads", strconv.Itoa(opts.Threads)}
+}
+
+// clipArgs returns the input seek options for a clip, or nothing when the whole input is converted
+func clipArgs(opts EncodeOptions) []string {
+	var args []string
+	if opts.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(opts.Start, 'f', 3, 64))
+	}
+	if opts.Duration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(opts.Duration, 'f', 3, 64))
+	}
+	return args
+}
+
+// buildFirstPassArgs assembles the analysis pass of a two-pass encode; only the video of the main input
+// is encoded, with the codec, bitrates and filters of the second pass, and the output is discarded.
+// DASH-only options such as -adaptation_sets can't be used with the null muxer.
+func buildFirstPassArgs(input string, opts EncodeOptions) []string {
+	video := opts
+	video.AudioTracks, video.Subtitles = nil, nil
+	args := inputArgs(input, video)
+
+	burnIn := burnInFilter(opts)
+	if len(opts.Renditions) == 0 {
+		args = append(args, "-map", "0:v:0", "-c:v", "libx264")
+		if burnIn != "" {
+			args = append(args, "-filter:v", burnIn)
+		}
+	} else {
+		args = append(args, renditionArgs(opts, burnIn)...)
+	}
+	args = append(args, threadArgs(opts)...)
+	return append(args,
+		"-pass", "1", "-passlogfile", opts.PassLogFile,
+		"-an", "-sn",
+		"-f", "null", os.DevNull,
+	)
+}
+
+// buildArgs assembles the ffmpeg arguments for the DASH encode
+func buildArgs(input, outputDir string, opts EncodeOptions) []string {
+	args := inputArgs(input, opts)
+	args = append(args, streamArgs(opts)...)
+
+	if opts.PassLogFile != "" {
+		// o mesmo codec da primeira passada, que nao depende do padrao do muxer
+		if len(opts.Renditions) == 0 {
+			args = append(args, "-c:v", "libx264")
+		}
+		args = append(args, "-pass", "2", "-passlogfile", opts.PassLogFile)
+	}
+
+	args = append(args, loudnormArgs(opts)...)
+
+	// Criptografia CENC repassada ao muxer mp4 usado pelo dash
+	if opts.Encryption != nil {
+		args = append(args, "-format_options", fmt.Sprintf("encryption_scheme=%s:encryption_key=%s:encryption_kid=%s",
+			opts.EncryptionScheme, opts.Encryption.Key, opts.Encryption.KeyID))
+	}
+
+	if opts.SingleFile {
+		args = append(args, "-single_file", "1")
+	}
+	args = append(args, perRenditionArgs(opts)...)
+
+	// CMAF: os mesmos fragmentos fmp4 servem o manifesto DASH e a playlist HLS
+	if opts.HLSPlaylist {
+		args = append(args, "-dash_segment_type", "mp4", "-hls_playlist", "1")
+	}
+
+	args = append(args, threadArgs(opts)...)
+	args = append(args, opts.ExtraArgs...)
+
+	args = append(args,
+		"-f", "dash", // Formato de saída
+		filepath.Join(outputDir, "output.mpd"), // Caminho para salvar o arquivo .mpd
+	)
+	return args
+}
+
+// renditionArgs maps one copy of the input video per rendition and sets its bitrate and scale
+func renditionArgs(opts EncodeOptions, burnIn string) []string {
+	var args []string
+	// uma copia do video de entrada para cada qualidade do perfil
+	for range opts.Renditions {
+		args = append(args, "-map", "0:v:0")
+	}
+	args = append(args, "-c:v", "libx264")
+	for i, rendition := range opts.Renditions {
+		args = append(args,
+			"-b:v:"+strconv.Itoa(i), rendition.VideoBitrate,
+			// legenda desenhada antes do scale, no tamanho original
+			"-filter:v:"+strconv.Itoa(i), joinFilters(burnIn, rendition.scaleFilter()),
+		)
+	}
+	return args
+}
+
+// streamArgs selects the streams that go into the manifest and how each video rendition is encoded.
+// Without renditions, audio tracks or subtitles ffmpeg's default stream selection is kept.
+func streamArgs(opts EncodeOptions) []string {
+	burnIn := burnInFilter(opts)
+	if len(opts.Renditions) == 0 && len(opts.AudioTracks) == 0 && len(opts.Subtitles) == 0 {
+		if burnIn != "" {
+			return []string{"-vf", burnIn}
+		}
+		return nil
+	}
+
+	var args []string
+	videoStreams := 1
+	if len(opts.Renditions) == 0 {
+		args = append(args, "-map", "0:v?")
+		if burnIn != "" {
+			args = append(args, "-filter:v", burnIn)
+		}
+	} else {
+		args = append(args, renditionArgs(opts, burnIn)...)
+		videoStreams = len(opts.Renditions)
+	}
+
+	adaptationSets := "id=0,streams=v"
+	if len(opts.AudioTracks) == 0 {
+		args = append(args, "-map", "0:a?")
+		adaptationSets += " id=1,streams=a"
+	} else {
+		// cada idioma vira um adaptation set proprio com o atributo lang
+		for i, track := range opts.AudioTracks {
+			args = append(args,
+				"-map", strconv.Itoa(i+1)+":a:0",
+				"-metadata:s:a:"+strconv.Itoa(i), "language="+track.Language,
+			)
+			adaptationSets += fmt.Sprintf(" id=%d,streams=%d", i+1, videoStreams+i)
+		}
+	}
+	if opts.AudioBitrate != "" {
+		args = append(args, "-c:a", "aac", "-b:a", opts.AudioBitrate)
+	}
+
+	if len(opts.Subtitles) > 0 {
+		// adiciona cada legenda como uma trilha de texto; as entradas de legenda vem depois das de audio
+		firstInput := len(opts.AudioTracks) + 1
+		for i := range opts.Subtitles {
+			args = append(args, "-map", strconv.Itoa(firstInput+i)+":s")
+		}
+		args = append(args, "-c:s", "webvtt")
+		adaptationSets += fmt.Sprintf(" id=%d,streams=s", len(opts.AudioTracks)+2)
+	}
+	return append(args, "-adaptation_sets", adaptationSets)
+}
@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// EncryptionKey is the content key used to encrypt the DASH segments, both values hex encoded
+type EncryptionKey struct {
+	KeyID string `json:"kid"`
+	Key   string `json:"key"`
+}
+
+// EncryptionInfo is the public part of the encryption setup, safe to publish downstream
+type EncryptionInfo struct {
+	Scheme string `json:"scheme"`
+	KeyID  string `json:"kid"`
+}
+
+// validate checks that kid and key are 16 byte hex values as required by CENC
+func (k *EncryptionKey) validate() error {
+	for name, value := range map[string]string{"kid": k.KeyID, "key": k.Key} {
+		decoded, err := hex.DecodeString(value)
+		if err != nil || len(decoded) != 16 {
+			return fmt.Errorf("encryption %s must be 32 hex characters", name)
+		}
+	}
+	return nil
+}
+
+// resolveEncryptionKey picks the key sent with the task or asks the key server for one
+func (vc *VideoConverter) resolveEncryptionKey(ctx context.Context, task *VideoTask) (*EncryptionKey, error) {
+	key := task.Encryption
+	if key == nil {
+		if vc.cfg.KeyServerURL == "" {
+			return nil, fmt.Errorf("encryption is enabled but the task has no key and no key server is configured")
+		}
+
+		var err error
+		key, err = fetchEncryptionKey(ctx, vc.cfg.KeyServerURL, task.VideoId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// fetchEncryptionKey requests the key for a video from the key server, which answers {"kid": "...", "key": "..."}
+func fetchEncryptionKey(ctx context.Context, keyServerURL string, videoID int) (*EncryptionKey, error) {
+	endpoint, err := url.Parse(keyServerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key server url: %v", err)
+	}
+	query := endpoint.Query()
+	query.Set("video_id", strconv.Itoa(videoID))
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build key request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request encryption key: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key server returned status %d", resp.StatusCode)
+	}
+
+	var key EncryptionKey
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %v", err)
+	}
+	return &key, nil
+}
@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"syscall"
+)
+
+// Conversion failures by stage. They wrap the underlying error, so errors.Is works on both the stage and
+// the cause (e.g. ErrMergeFailed together with ErrInputRejected for an oversized merge). The other
+// sentinels are ErrNoChunks, ErrInputRejected, ErrMaxAttempts and ErrDBTimeout.
+var (
+	// ErrMergeFailed is returned when the chunks couldn't be merged into a single input
+	ErrMergeFailed = errors.New("failed to merge chunks")
+	// ErrProbeFailed is returned when ffprobe can't read the merged input
+	ErrProbeFailed = errors.New("failed to probe input")
+	// ErrFFmpegFailed matches every *FFmpegError
+	ErrFFmpegFailed = errors.New("ffmpeg failed")
+	// ErrInvalidManifest is returned when ffmpeg exited cleanly but the DASH manifest is missing or broken
+	ErrInvalidManifest = errors.New("invalid DASH manifest")
+	// ErrDiskFull matches writes that failed with ENOSPC, from Go or from ffmpeg. It's requeued rather
+	// than dead-lettered: another instance, or this one after cleanup, can still convert the video.
+	ErrDiskFull = errors.New("no space left on device")
+	// ErrDeviceUnavailable matches ffmpeg failures caused by the GPU (missing, busy, out of memory). It's
+	// requeued too, so the video can land on another instance or device.
+	ErrDeviceUnavailable = errors.New("hardware device unavailable")
+	// ErrCanceled is returned when an operator canceled the conversion with a control message
+	ErrCanceled = errors.New("conversion canceled")
+)
+
+// diskError marks err as ErrDiskFull when it was caused by a full disk
+func diskError(err error) error {
+	if err != nil && errors.Is(err, syscall.ENOSPC) && !errors.Is(err, ErrDiskFull) {
+		return errors.Join(ErrDiskFull, err)
+	}
+	return err
+}
+
+// ErrorKind names the taxonomy entry of err for logs, failure events and metrics; "unknown" when none applies
+func ErrorKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrDiskFull):
+		return "disk_full"
+	case errors.Is(err, ErrDeviceUnavailable):
+		return "device_unavailable"
+	case errors.Is(err, ErrMaxAttempts):
+		return "max_attempts"
+	case errors.Is(err, ErrNoChunks):
+		return "no_chunks"
+	case errors.Is(err, ErrInputRejected):
+		return "input_rejected"
+	case errors.Is(err, ErrDBTimeout):
+		return "db_timeout"
+	case errors.Is(err, ErrMergeFailed):
+		return "merge_failed"
+	case errors.Is(err, ErrProbeFailed):
+		return "probe_failed"
+	case errors.Is(err, ErrInvalidManifest):
+		return "invalid_manifest"
+	case errors.Is(err, ErrFFmpegFailed):
+		return "ffmpeg_failed"
+	case errors.Is(err, ErrCanceled):
+		return "canceled"
+	case errors.Is(err, ErrVideoClaimed):
+		return "claimed"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "unknown"
+}
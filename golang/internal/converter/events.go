@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// State transitions recorded in video_events
+const (
+	EventClaimed      = "claimed"
+	EventMerging      = "merging"
+	EventConverting   = "converting"
+	EventSucceeded    = "succeeded"
+	EventFailed       = "failed"
+	EventDeadLettered = "dead_lettered"
+	EventCanceled     = "canceled"
+)
+
+// AppendEvent adds a state transition to the append-only history of the video
+func AppendEvent(ctx context.Context, db *sql.DB, videoID int, event, detail, workerID string) error {
+	query := "INSERT INTO video_events (video_id, event, detail, worker_id, created_at) VALUES ($1, $2, $3, $4, $5)"
+	_, err := db.ExecContext(ctx, query, videoID, event, detail, workerID, time.Now())
+	if err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+// recordEvent appends an event for the task. The history is for investigations only, so a failed
+// insert is logged and doesn't fail the conversion.
+func (vc *VideoConverter) recordEvent(ctx context.Context, videoID int, event, detail string) {
+	if vc.db == nil {
+		return
+	}
+	dbCtx, cancel := vc.dbContext(ctx)
+	defer cancel()
+	if err := AppendEvent(dbCtx, vc.db, videoID, event, detail, vc.cfg.WorkerID); err != nil {
+		slog.Warn("Failed to record video event", slog.Int("video_id", videoID), slog.String("event", event),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,52 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseFlagList splits a comma-separated list of ffmpeg flags such as "-crf,-tune,-b:v"
+func ParseFlagList(list string) []string {
+	var flags []string
+	for _, flag := range strings.Split(list, ",") {
+		if flag = strings.TrimSpace(flag); flag != "" {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// checkExtraArgs accepts extra_args only as flag/value pairs whose flags are allow-listed. A lone value
+// would be read by ffmpeg as another output file, so values can't start with "-" or contain path separators.
+// An allowed flag also covers its stream specifiers: "-b:v" allows "-b:v:0".
+func checkExtraArgs(args, allowed []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("%w: extra_args are not enabled on this worker", ErrInputRejected)
+	}
+	if len(args)%2 != 0 {
+		return fmt.Errorf("%w: extra_args must be flag/value pairs, got %d items", ErrInputRejected, len(args))
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		flag, value := args[i], args[i+1]
+		if !flagAllowed(flag, allowed) {
+			return fmt.Errorf("%w: ffmpeg flag %q is not allowed in extra_args", ErrInputRejected, flag)
+		}
+		if strings.HasPrefix(value, "-") || strings.ContainsAny(value, `/\`) {
+			return fmt.Errorf("%w: invalid value %q for %s in extra_args", ErrInputRejected, value, flag)
+		}
+	}
+	return nil
+}
+
+func flagAllowed(flag string, allowed []string) bool {
+	for _, entry := range allowed {
+		if flag == entry || strings.HasPrefix(flag, entry+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package converter
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// FailureEvent is published when a video fails permanently, so downstream services can notify the user
+type FailureEvent struct {
+	VideoId int       `json:"video_id"`
+	Path    string    `json:"path"`
+	Error   string    `json:"error"`
+	Kind    string    `json:"kind"`
+	Details string    `json:"details"`
+	Time    time.Time `json:"time"`
+}
+
+// publishFailure emits a FailureEvent to the configured error exchange; it's a no-op when none is configured
+func (vc *VideoConverter) publishFailure(task VideoTask, message string, err error) {
+	if vc.cfg.ErrorExchange == "" || vc.publisher == nil {
+		return
+	}
+
+	event, _ := json.Marshal(FailureEvent{
+		VideoId: task.VideoId,
+		Path:    task.Path,
+		Error:   message,
+		Kind:    ErrorKind(err),
+		Details: err.Error(),
+		Time:    time.Now(),
+	})
+
+	if pubErr := vc.publisher.PublishMessage(vc.cfg.ErrorExchange, vc.cfg.ErrorKey, vc.cfg.ErrorQueue, event); pubErr != nil {
+		slog.Error("Failed to publish failure event", slog.Int("video_id", task.VideoId), slog.String("error", pubErr.Error()))
+	}
+}
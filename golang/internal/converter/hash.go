@@ -0,0 +1,39 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNoChunks is returned when the task path has no files matching the chunk pattern
+var ErrNoChunks = errors.New("no chunks found matching pattern")
+
+// contentHash returns the SHA-256 of the task's chunks concatenated in merge order.
+// It returns an empty hash when the chunks are already gone (e.g. cleaned up after a previous run).
+func (vc *VideoConverter) contentHash(task VideoTask) (string, error) {
+	chunks, err := vc.taskChunks(task)
+	if errors.Is(err, ErrNoChunks) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, chunk := range chunks {
+		input, err := os.Open(chunk)
+		if err != nil {
+			return "", fmt.Errorf("failed to open chunk %s: %v", chunk, err)
+		}
+		_, err = io.Copy(hash, input)
+		input.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to hash chunk %s: %v", chunk, err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
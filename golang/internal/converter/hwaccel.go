@@ -0,0 +1,88 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultHardwareAccel lets ffmpeg pick the decoder API, falling back to software when it fails
+const DefaultHardwareAccel = "auto"
+
+// deviceErrors are ffmpeg messages about a GPU that is missing, busy or failed to initialize
+var deviceErrors = []string{
+	"Device creation failed",
+	"Failed to create a device",
+	"No device available for decoder",
+	"Failed to initialise VAAPI",
+	"No VA display found",
+	"Failed to open the DRM device",
+	"Cannot load libcuda",
+	"CUDA_ERROR_NO_DEVICE",
+	"CUDA_ERROR_INVALID_DEVICE",
+	"CUDA_ERROR_OUT_OF_MEMORY",
+}
+
+// isDeviceError reports whether ffmpeg's output points at the hardware device rather than the input
+func isDeviceError(output string) bool {
+	for _, message := range deviceErrors {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// hardwareAccel returns the configured -hwaccel API or the default
+func (c Config) hardwareAccel() string {
+	if c.HardwareAccelType != "" {
+		return c.HardwareAccelType
+	}
+	return DefaultHardwareAccel
+}
+
+// hwaccelArgs returns the decoder options for hardware acceleration, pinned to the device when one is set
+func hwaccelArgs(opts EncodeOptions) []string {
+	if !opts.HardwareAccel {
+		return nil
+	}
+	accel := opts.HardwareAccelType
+	if accel == "" {
+		accel = DefaultHardwareAccel
+	}
+	args := []string{"-hwaccel", accel}
+	if opts.HardwareDevice != "" {
+		args = append(args, "-hwaccel_device", opts.HardwareDevice)
+	}
+	return args
+}
+
+// CheckHardwareDevice verifies at startup that the configured device exists and, for an explicit API,
+// that ffmpeg can initialize it, so a misconfigured host fails fast instead of on every conversion
+func CheckHardwareDevice(ctx context.Context, cfg Config) error {
+	if !cfg.Features.HardwareAccel || cfg.HardwareDevice == "" {
+		return nil
+	}
+	// caminhos como /dev/dri/renderD128; indices de GPU sao checados pelo ffmpeg
+	if strings.HasPrefix(cfg.HardwareDevice, "/") {
+		if _, err := os.Stat(cfg.HardwareDevice); err != nil {
+			return fmt.Errorf("hardware device %s: %v", cfg.HardwareDevice, err)
+		}
+	}
+	accel := cfg.hardwareAccel()
+	if accel == DefaultHardwareAccel {
+		return nil
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error",
+		"-init_hw_device", accel + "=gpu:" + cfg.HardwareDevice,
+		"-f", "lavfi", "-i", "nullsrc=s=64x64:d=0.1",
+		"-f", "null", "-",
+	}
+	if out, err := exec.CommandContext(ctx, ffmpegBinary, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to initialize %s device %s: %v: %s", accel, cfg.HardwareDevice, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -1,42 +1,167 @@
 package converter
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"time"
 )
 
-func IsProcessed(db *sql.DB, videoId int) bool {
+// IsProcessed reports whether the video was converted successfully from the same content.
+// An empty contentHash matches on video_id alone.
+func IsProcessed(ctx context.Context, db *sql.DB, videoId int, contentHash string) (bool, error) {
 	var isProcessed bool
 
-	query := "SELECT EXISTS(SELECT 1 FROM processed_videos where video_id = $1 and status = 'success')"
+	query := "SELECT EXISTS(SELECT 1 FROM processed_videos where video_id = $1 and status = 'success' and ($2 = '' or content_hash = $2))"
 
-	err := db.QueryRow(query, videoId).Scan(&isProcessed)
+	err := db.QueryRowContext(ctx, query, videoId, contentHash).Scan(&isProcessed)
 
 	if err != nil {
 		slog.Error("error checking if video is processed", slog.Int("videos_id", videoId))
-		return false
+		return false, dbError(err)
 	}
-	return isProcessed
+	return isProcessed, nil
 }
 
-// MarkProcessed registers that the video has been processed successfully
-func MarkProcessed(db *sql.DB, videoID int) error {
-	query := "INSERT INTO processed_videos (video_id, status, processed_at) VALUES ($1, $2, $3)"
-	_, err := db.Exec(query, videoID, "success", time.Now())
+// StatusFailed is the status of a video whose last attempt failed and will be retried
+const StatusFailed = "failed"
+
+// StatusFailedPermanent is the terminal status of a video that used up its MaxAttempts; redeliveries are
+// dropped until it's resubmitted with force
+const StatusFailedPermanent = "failed_permanent"
+
+// VideoStatus is the recorded processing state of a video
+type VideoStatus struct {
+	Status      string
+	Attempts    int
+	ProcessedAt time.Time
+	// LastError is the final error of a permanently failed video
+	LastError string
+}
+
+// GetStatus returns the recorded status of the video, how many conversions were attempted and when it was
+// last updated. A video that was never attempted has an empty status and zero attempts.
+func GetStatus(ctx context.Context, db *sql.DB, videoID int) (VideoStatus, error) {
+	var status VideoStatus
+
+	query := "SELECT status, attempts, processed_at, last_error FROM processed_videos WHERE video_id = $1"
+
+	var lastError sql.NullString
+	err := db.QueryRowContext(ctx, query, videoID).Scan(&status.Status, &status.Attempts, &status.ProcessedAt, &lastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return VideoStatus{}, nil
+	}
+	if err != nil {
+		return VideoStatus{}, dbError(err)
+	}
+	status.LastError = lastError.String
+	return status, nil
+}
+
+// MarkFailedPermanent moves the video to the terminal failed_permanent status, keeping the final error
+func MarkFailedPermanent(ctx context.Context, db *sql.DB, videoID int, finalError string) error {
+	query := "UPDATE processed_videos SET status = $2, last_error = $3, processed_at = $4, claimed_at = NULL WHERE video_id = $1"
+	_, err := db.ExecContext(ctx, query, videoID, StatusFailedPermanent, finalError, time.Now())
+	if err != nil {
+		slog.Error("Error marking video as permanently failed", slog.Int("video_id", videoID), slog.String("error", err.Error()))
+		return dbError(err)
+	}
+	return nil
+}
+
+// ResetAttempts gives a failed video a fresh attempt budget, e.g. before its dead-lettered task is replayed.
+// Converted videos are left alone so the replay is still skipped as a duplicate, and so are videos being
+// processed: clearing a live claim would let a second worker convert the same video.
+func ResetAttempts(ctx context.Context, db *sql.DB, videoID int) error {
+	query := `UPDATE processed_videos SET status = $2, attempts = 0, last_error = NULL, claimed_at = NULL
+		WHERE video_id = $1 AND status IN ($2, $3, $4)`
+	_, err := db.ExecContext(ctx, query, videoID, StatusFailed, StatusFailedPermanent, StatusCanceled)
+	return dbError(err)
+}
+
+// FailedVideo is a permanently failed video as listed by ListPermanentlyFailed
+type FailedVideo struct {
+	VideoID   int       `json:"video_id"`
+	Attempts  int       `json:"attempts"`
+	FailedAt  time.Time `json:"failed_at"`
+	LastError string    `json:"last_error"`
+}
+
+// ListPermanentlyFailed returns the videos in failed_permanent, most recent first
+func ListPermanentlyFailed(ctx context.Context, db *sql.DB, limit int) ([]FailedVideo, error) {
+	query := `SELECT video_id, attempts, processed_at, COALESCE(last_error, '') FROM processed_videos
+		WHERE status = $1 ORDER BY processed_at DESC LIMIT $2`
+	rows, err := db.QueryContext(ctx, query, StatusFailedPermanent, limit)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	videos := []FailedVideo{}
+	for rows.Next() {
+		var video FailedVideo
+		if err := rows.Scan(&video.VideoID, &video.Attempts, &video.FailedAt, &video.LastError); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// MarkFailed records a failed conversion attempt, incrementing the attempt counter
+func MarkFailed(ctx context.Context, db *sql.DB, videoID int, contentHash string) error {
+	query := `INSERT INTO processed_videos (video_id, status, processed_at, content_hash, attempts) VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (video_id) DO UPDATE SET status = EXCLUDED.status, processed_at = EXCLUDED.processed_at,
+			content_hash = EXCLUDED.content_hash, attempts = processed_videos.attempts + 1, claimed_at = NULL,
+			result = CASE WHEN processed_videos.content_hash = EXCLUDED.content_hash THEN processed_videos.result END`
+	_, err := db.ExecContext(ctx, query, videoID, StatusFailed, time.Now(), contentHash)
+	if err != nil {
+		slog.Error("Error marking video as failed", slog.Int("video_id", videoID), slog.String("error", err.Error()))
+		return dbError(err)
+	}
+	return nil
+}
+
+// MarkProcessed registers that the video has been processed successfully from the content with the given hash,
+// recording where the output went and its size
+func MarkProcessed(ctx context.Context, db *sql.DB, videoID int, contentHash string, result *ConversionResult) error {
+	return markProcessed(ctx, db, videoID, contentHash, result)
+}
+
+// dbExecer is satisfied by *sql.DB and *sql.Tx
+type dbExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func markProcessed(ctx context.Context, db dbExecer, videoID int, contentHash string, result *ConversionResult) error {
+	// o resultado completo permite reaproveitar a saida numa reentrega (ver existingOutput)
+	stored, err := json.Marshal(result)
 	if err != nil {
-		slog.Error("Error marking video as processed", slog.Int("video_id", videoID), slog.String("error", err.Error()))
 		return err
 	}
+	// attempts conta so falhas consecutivas: um sucesso zera o contador, senao reprocessamentos bem-sucedidos
+	// consumiriam o MaxAttempts
+	query := `INSERT INTO processed_videos (video_id, status, processed_at, content_hash, attempts, manifest_path, output_bytes, duration, result)
+		VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8)
+		ON CONFLICT (video_id) DO UPDATE SET status = EXCLUDED.status, processed_at = EXCLUDED.processed_at,
+			content_hash = EXCLUDED.content_hash, attempts = 0, claimed_at = NULL,
+			manifest_path = EXCLUDED.manifest_path, output_bytes = EXCLUDED.output_bytes, duration = EXCLUDED.duration,
+			result = EXCLUDED.result`
+	_, err = db.ExecContext(ctx, query, videoID, "success", time.Now(), contentHash, result.ManifestPath, result.Size, result.Duration, stored)
+	if err != nil {
+		slog.Error("Error marking video as processed", slog.Int("video_id", videoID), slog.String("error", err.Error()))
+		return dbError(err)
+	}
 	return nil
 }
 
 // RegisterError stores the error details and phase history in the database
-func RegisterError(db *sql.DB, errorData map[string]interface{}, err error) {
+func RegisterError(ctx context.Context, db *sql.DB, errorData map[string]interface{}, err error) {
 	serializedError, _ := json.Marshal(errorData)
 	query := "INSERT INTO process_errors_log (error_details, created_at) VALUES ($1, $2)"
-	_, dbErr := db.Exec(query, serializedError, time.Now())
+	_, dbErr := db.ExecContext(ctx, query, serializedError, time.Now())
 	if dbErr != nil {
 		slog.Error("Error storing error log in database", slog.String("error", dbErr.Error()))
 		return
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types of a task: chunks of a video (default) or numbered still images encoded as a timelapse
+const (
+	MediaTypeVideo         = "video"
+	MediaTypeImageSequence = "image_sequence"
+)
+
+// DefaultFramePattern and DefaultFramerate apply to image sequence tasks that don't set their own
+const (
+	DefaultFramePattern = "frame_%04d.png"
+	DefaultFramerate    = 25
+)
+
+// framePatternRegexp matches a printf-style frame pattern with a single %d or %0Nd, as image2 expects
+var framePatternRegexp = regexp.MustCompile(`^([^%]*)%(0\d+)?d([^%]*)$`)
+
+func validMediaType(mediaType string) bool {
+	return mediaType == "" || mediaType == MediaTypeVideo || mediaType == MediaTypeImageSequence
+}
+
+// validFramePattern checks the pattern is a file name with exactly one frame number verb
+func validFramePattern(pattern string) bool {
+	return framePatternRegexp.MatchString(pattern) && !strings.ContainsAny(pattern, `/\`)
+}
+
+// framePattern returns the task's frame pattern or the default
+func framePattern(task VideoTask) string {
+	if task.FramePattern != "" {
+		return task.FramePattern
+	}
+	return DefaultFramePattern
+}
+
+// framerate returns the task's framerate, falling back to the configured default
+func (vc *VideoConverter) framerate(task VideoTask) float64 {
+	if task.Framerate > 0 {
+		return task.Framerate
+	}
+	if vc.cfg.ImageSequenceFramerate > 0 {
+		return vc.cfg.ImageSequenceFramerate
+	}
+	return DefaultFramerate
+}
+
+// findFrames returns the frames of an image sequence task in order, along with the first frame number.
+// image2 stops at the first missing number, so a gap would silently truncate the video: it's rejected.
+func findFrames(task VideoTask) ([]string, int, error) {
+	pattern := framePattern(task)
+	parts := framePatternRegexp.FindStringSubmatch(pattern)
+	if parts == nil {
+		return nil, 0, fmt.Errorf("%w: invalid frame pattern %q", ErrInputRejected, pattern)
+	}
+	prefix, width, suffix := parts[1], 0, parts[3]
+	if parts[2] != "" {
+		width, _ = strconv.Atoi(parts[2])
+	}
+
+	matches, err := filepath.Glob(filepath.Join(task.Path, globEscape(prefix)+"*"+globEscape(suffix)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find frames: %v", err)
+	}
+	frames := make(map[int]string, len(matches))
+	for _, match := range matches {
+		digits := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), prefix), suffix)
+		number, err := strconv.Atoi(digits)
+		if err != nil || number < 0 || (width > 0 && len(digits) < width) || (width == 0 && strconv.Itoa(number) != digits) {
+			continue
+		}
+		frames[number] = match
+	}
+	if len(frames) == 0 {
+		return nil, 0, fmt.Errorf("%w: frame pattern %s in %s", ErrNoChunks, pattern, task.Path)
+	}
+
+	numbers := make([]int, 0, len(frames))
+	for number := range frames {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	ordered := make([]string, 0, len(numbers))
+	for i, number := range numbers {
+		if i > 0 && number != numbers[i-1]+1 {
+			return nil, 0, fmt.Errorf("%w: frames %d to %d are missing from the sequence", ErrInputRejected, numbers[i-1]+1, number-1)
+		}
+		ordered = append(ordered, frames[number])
+	}
+	return ordered, numbers[0], nil
+}
+
+// globEscape escapes the glob metacharacters in a literal part of a file name
+func globEscape(s string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(s)
+}
+
+// encodeImageSequence encodes the task's frames into outputFile with the image2 demuxer, taking the place
+// of the chunk merge. Odd dimensions are rounded down because yuv420p requires even ones.
+func (vc *VideoConverter) encodeImageSequence(ctx context.Context, task VideoTask, outputFile string) error {
+	_, start, err := findFrames(task)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-y",
+		"-f", "image2",
+		"-framerate", strconv.FormatFloat(vc.framerate(task), 'f', -1, 64),
+		"-start_number", strconv.Itoa(start),
+		"-i", filepath.Join(task.Path, framePattern(task)),
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:v", "libx264", "-pix_fmt", "yuv420p",
+		outputFile,
+	}
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputFile)
+		return &FFmpegError{Args: args, Output: string(out), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StartJanitor periodically removes stale intermediate artifacts left by crashed conversions
+// until ctx is canceled. It's a no-op unless JanitorInterval is set.
+func (vc *VideoConverter) StartJanitor(ctx context.Context) {
+	if vc.cfg.JanitorInterval <= 0 {
+		return
+	}
+
+	slog.Info("Janitor started",
+		slog.String("media_root", vc.cfg.MediaRoot),
+		slog.Duration("interval", vc.cfg.JanitorInterval),
+		slog.Duration("max_age", vc.cfg.JanitorMaxAge))
+
+	ticker := time.NewTicker(vc.cfg.JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			vc.sweep()
+		}
+	}
+}
+
+// sweep runs one janitor pass over the media root, the work dir and the pending cleanups table
+func (vc *VideoConverter) sweep() {
+	// Outro worker pode estar convertendo o video enquanto o claim dele vale: nada mais novo que
+	// ClaimTTL e considerado abandonado
+	cutoff := time.Now().Add(-max(vc.cfg.JanitorMaxAge, vc.cfg.ClaimTTL))
+
+	if vc.cfg.MediaRoot != "" {
+		vc.sweepMediaRoot(cutoff)
+	}
+	if vc.cfg.WorkDir != "" {
+		vc.sweepWorkDir(cutoff)
+	}
+	if vc.db != nil {
+		vc.sweepPendingCleanups()
+		vc.ReclaimStaleClaims()
+	}
+}
+
+// ReclaimStaleClaims releases processing claims older than ClaimTTL, left by workers that crashed mid-conversion
+func (vc *VideoConverter) ReclaimStaleClaims() {
+	if vc.cfg.ClaimTTL <= 0 {
+		return
+	}
+	ctx, cancel := vc.dbContext(context.Background())
+	defer cancel()
+	released, err := ReclaimStale(ctx, vc.db, vc.cfg.ClaimTTL)
+	if err != nil {
+		slog.Warn("Failed to reclaim stale claims", slog.String("error", err.Error()))
+		return
+	}
+	if released > 0 {
+		slog.Info("Released stale claims", slog.Int64("videos", released))
+	}
+}
+
+// sweepMediaRoot removes old merged.mp4 files (when Features.Cleanup is on) and empty directories under
+// mpeg-dash outside active conversions
+func (vc *VideoConverter) sweepMediaRoot(cutoff time.Time) {
+	var emptyDirs []string
+
+	err := filepath.WalkDir(vc.cfg.MediaRoot, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			slog.Warn("Janitor failed to read path", slog.String("path", path), slog.String("error", err.Error()))
+			return nil
+		}
+		if vc.isActivePath(path) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		switch {
+		case !entry.IsDir() && entry.Name() == "merged.mp4" && vc.cfg.Features.Cleanup:
+			vc.janitorRemove(path)
+		case entry.IsDir() && isOutputDir(path):
+			emptyDirs = append(emptyDirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Janitor failed to scan media root", slog.String("error", err.Error()))
+	}
+
+	// de tras pra frente para remover os diretorios filhos antes dos pais
+	for i := len(emptyDirs) - 1; i >= 0; i-- {
+		dir := emptyDirs[i]
+		entries, err := os.ReadDir(dir)
+		if err == nil && len(entries) == 0 {
+			vc.janitorRemove(dir)
+		}
+	}
+}
+
+// sweepWorkDir removes old task work dirs (video-<id>) whose video isn't being converted, here or by
+// another worker holding a live claim
+func (vc *VideoConverter) sweepWorkDir(cutoff time.Time) {
+	entries, err := os.ReadDir(vc.cfg.WorkDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "video-") {
+			continue
+		}
+		idPart := strings.SplitN(strings.TrimPrefix(entry.Name(), "video-"), "-", 2)[0]
+		if videoID, err := strconv.Atoi(idPart); err == nil {
+			if _, active := vc.inFlight.Load(videoID); active || vc.isClaimed(videoID) {
+				continue
+			}
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		path := filepath.Join(vc.cfg.WorkDir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			slog.Warn("Janitor failed to remove work dir", slog.String("path", path), slog.String("error", err.Error()))
+			continue
+		}
+		slog.Info("Janitor removed stale work dir", slog.String("path", path))
+	}
+}
+
+// sweepPendingCleanups retries files that processVideo failed to delete
+func (vc *VideoConverter) sweepPendingCleanups() {
+	ctx, cancel := vc.dbContext(context.Background())
+	paths, err := ListPendingCleanups(ctx, vc.db)
+	cancel()
+	if err != nil {
+		slog.Warn("Janitor failed to list pending cleanups", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, path := range paths {
+		if vc.isActivePath(path) {
+			continue
+		}
+		if err := removeWithRetry(path); err != nil {
+			slog.Warn("Janitor failed to remove pending cleanup", slog.String("path", path), slog.String("error", err.Error()))
+			continue
+		}
+		ctx, cancel := vc.dbContext(context.Background())
+		err := DeletePendingCleanup(ctx, vc.db, path)
+		cancel()
+		if err != nil {
+			slog.Warn("Janitor failed to clear pending cleanup", slog.String("path", path), slog.String("error", err.Error()))
+			continue
+		}
+		slog.Info("Janitor removed pending cleanup", slog.String("path", path))
+	}
+}
+
+// isOutputDir reports whether the directory is (or is inside) an mpeg-dash output tree
+func isOutputDir(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == "mpeg-dash" {
+			return true
+		}
+	}
+	return false
+}
+
+// isClaimed reports whether a worker holds a live claim on the video. Without a database only the
+// conversions of this worker count; a failed lookup keeps the files.
+func (vc *VideoConverter) isClaimed(videoID int) bool {
+	if vc.db == nil {
+		return false
+	}
+	ctx, cancel := vc.dbContext(context.Background())
+	defer cancel()
+	claimed, err := IsClaimed(ctx, vc.db, videoID, vc.cfg.ClaimTTL)
+	if err != nil {
+		slog.Warn("Janitor failed to check claim", slog.Int("video_id", videoID), slog.String("error", err.Error()))
+		return true
+	}
+	return claimed
+}
+
+// isActivePath reports whether path belongs to a conversion currently running in this worker
+func (vc *VideoConverter) isActivePath(path string) bool {
+	active := false
+	vc.inFlight.Range(func(_, value any) bool {
+		taskPath := value.(*runningConversion).path
+		if taskPath != "" && (path == taskPath || strings.HasPrefix(path, taskPath+string(filepath.Separator))) {
+			active = true
+			return false
+		}
+		return true
+	})
+	return active
+}
+
+// janitorRemove deletes a stale artifact and logs what was cleaned
+func (vc *VideoConverter) janitorRemove(path string) {
+	if err := os.Remove(path); err != nil {
+		slog.Warn("Janitor failed to remove artifact", slog.String("path", path), slog.String("error", err.Error()))
+		return
+	}
+	slog.Info("Janitor removed stale artifact", slog.String("path", path))
+}
+
+// ListPendingCleanups returns the files recorded by RecordPendingCleanup
+func ListPendingCleanups(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT path FROM pending_cleanups ORDER BY created_at")
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// DeletePendingCleanup forgets a pending cleanup once the file is gone
+func DeletePendingCleanup(ctx context.Context, db *sql.DB, path string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM pending_cleanups WHERE path = $1", path)
+	return dbError(err)
+}
@@ -0,0 +1,46 @@
+package converter
+
+// ladderSteps is the reference bitrate ladder, from the highest quality down
+var ladderSteps = []Rendition{
+	{Name: "2160p", Height: 2160, VideoBitrate: "16000k"},
+	{Name: "1440p", Height: 1440, VideoBitrate: "9000k"},
+	{Name: "1080p", Height: 1080, VideoBitrate: "5000k"},
+	{Name: "720p", Height: 720, VideoBitrate: "2800k"},
+	{Name: "480p", Height: 480, VideoBitrate: "1400k"},
+	{Name: "360p", Height: 360, VideoBitrate: "800k"},
+	{Name: "240p", Height: 240, VideoBitrate: "400k"},
+}
+
+// autoLadder derives the renditions from the probed source resolution: every step up to the source height,
+// never upscaling; sources below the smallest step get a single rendition at their own height
+func autoLadder(width, height int) []Rendition {
+	if height <= 0 {
+		return nil
+	}
+
+	// Portrait sources are capped by their short side, like their landscape equivalent
+	shortSide := height
+	if width > 0 && width < height {
+		shortSide = width
+	}
+
+	var renditions []Rendition
+	for _, step := range ladderSteps {
+		if step.Height <= shortSide {
+			renditions = append(renditions, step)
+		}
+	}
+	if len(renditions) == 0 {
+		lowest := ladderSteps[len(ladderSteps)-1]
+		renditions = []Rendition{{Name: "source", Height: shortSide, VideoBitrate: lowest.VideoBitrate}}
+	}
+
+	if width > 0 && width < height {
+		// scaleFilter scales by height, so portrait renditions scale the width instead
+		for i := range renditions {
+			renditions[i].Width = renditions[i].Height
+			renditions[i].Height = -2
+		}
+	}
+	return renditions
+}
@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAutoLadder(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          []string
+	}{
+		{"4K", 3840, 2160, []string{"2160p", "1440p", "1080p", "720p", "480p", "360p", "240p"}},
+		{"1080p", 1920, 1080, []string{"1080p", "720p", "480p", "360p", "240p"}},
+		{"480p", 854, 480, []string{"480p", "360p", "240p"}},
+		{"below the smallest step", 320, 180, []string{"source"}},
+		{"portrait 1080p", 1080, 1920, []string{"1080p", "720p", "480p", "360p", "240p"}},
+		{"unknown height", 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renditions := autoLadder(tt.width, tt.height)
+			var names []string
+			for _, rendition := range renditions {
+				names = append(names, rendition.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("autoLadder(%d, %d) = %v, want %v", tt.width, tt.height, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoLadderNeverUpscales(t *testing.T) {
+	for _, rendition := range autoLadder(1280, 720) {
+		if rendition.Height > 720 {
+			t.Errorf("rendition %s is taller than the 720p source", rendition.Name)
+		}
+	}
+
+	source := autoLadder(320, 180)
+	if source[0].Height != 180 {
+		t.Errorf("small source rendition height = %d, want 180", source[0].Height)
+	}
+
+	// retrato escala a largura: a altura fica proporcional
+	portrait := autoLadder(1080, 1920)
+	if portrait[0].scaleFilter() != "scale=1080:-2" {
+		t.Errorf("portrait scale filter = %s, want scale=1080:-2", portrait[0].scaleFilter())
+	}
+}
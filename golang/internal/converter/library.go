@@ -0,0 +1,58 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+)
+
+// ConvertOptions are the per-call settings for ConvertDirectory
+type ConvertOptions struct {
+	// Profile is the name of an encode profile from Config.Profiles; empty uses ffmpeg defaults
+	Profile string
+	// ChunkPattern overrides the configured chunk glob
+	ChunkPattern string
+}
+
+// ConvertDirectory merges the chunks in path and converts them to MPEG-DASH inside the configured output subdir.
+// Unlike Handle it doesn't touch RabbitMQ or the database, so it can be used as a library or from the CLI.
+func (vc *VideoConverter) ConvertDirectory(ctx context.Context, path string, opts ConvertOptions) (ConversionResult, error) {
+	if path == "" {
+		return ConversionResult{}, fmt.Errorf("path is required")
+	}
+
+	// Library callers pick their own directories, so MEDIA_ROOT doesn't confine them
+	path, err := normalizeMediaPath(path, "")
+	if err != nil {
+		return ConversionResult{}, err
+	}
+	task := VideoTask{Path: path, Profile: opts.Profile, ChunkPattern: opts.ChunkPattern}
+
+	result, err := vc.processVideo(ctx, &task, nil)
+	if err != nil {
+		return ConversionResult{}, err
+	}
+	return *result, nil
+}
+
+// RunTask converts a task synchronously the way Handle does, with the idempotency checks, claims and status
+// tracking, but without RabbitMQ: no ack and no confirmation. It returns a nil result when the video was
+// skipped as already processed, and ErrVideoClaimed while the video is being converted elsewhere. Like a
+// delivery, it waits for the circuit breaker and for a free worker slot (Config.Workers).
+func (vc *VideoConverter) RunTask(ctx context.Context, task *VideoTask) (*ConversionResult, error) {
+	if err := task.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInputRejected, err)
+	}
+
+	if err := vc.breaker.Wait(ctx); err != nil {
+		return nil, err
+	}
+	if err := vc.slots.Acquire(ctx); err != nil {
+		vc.breaker.Record(outcomeNeutral)
+		return nil, err
+	}
+	defer vc.slots.Release()
+
+	result, err := vc.convertTask(ctx, task, nil)
+	vc.breaker.Record(breakerOutcomeOf(result, err))
+	return result, err
+}
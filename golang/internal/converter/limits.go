@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInputRejected marks inputs that can never be converted and should be dead-lettered instead of retried
+var ErrInputRejected = errors.New("input rejected")
+
+// ErrMaxAttempts is returned when a video already failed as many times as Config.MaxAttempts allows
+var ErrMaxAttempts = errors.New("max conversion attempts reached")
+
+// shouldDeadLetter reports whether retrying the conversion is pointless
+func shouldDeadLetter(err error) bool {
+	return errors.Is(err, ErrInputRejected) || errors.Is(err, ErrMaxAttempts)
+}
+
+// checkInputLimits rejects inputs longer or larger than the configured limits (zero disables a limit)
+func (vc *VideoConverter) checkInputLimits(metadata *VideoMetadata) error {
+	if vc.cfg.MaxDurationSeconds > 0 && metadata.Duration > float64(vc.cfg.MaxDurationSeconds) {
+		return fmt.Errorf("%w: duration %.0fs exceeds the limit of %ds", ErrInputRejected, metadata.Duration, vc.cfg.MaxDurationSeconds)
+	}
+	if vc.cfg.MaxInputBytes > 0 && metadata.Size > vc.cfg.MaxInputBytes {
+		return fmt.Errorf("%w: size %d bytes exceeds the limit of %d bytes", ErrInputRejected, metadata.Size, vc.cfg.MaxInputBytes)
+	}
+	return nil
+}
+
+// checkClipRange rejects a start/duration that doesn't fit inside the probed source
+func checkClipRange(task VideoTask, metadata *VideoMetadata) error {
+	if task.Start == 0 && task.Duration == 0 {
+		return nil
+	}
+	if task.Start >= metadata.Duration {
+		return fmt.Errorf("%w: start %.2fs is beyond the source duration of %.2fs", ErrInputRejected, task.Start, metadata.Duration)
+	}
+	if task.Start+task.Duration > metadata.Duration {
+		return fmt.Errorf("%w: clip %.2fs+%.2fs exceeds the source duration of %.2fs", ErrInputRejected, task.Start, task.Duration, metadata.Duration)
+	}
+	return nil
+}
+
+// clipDuration is the length of the converted output: the clip when one was requested, else the whole source
+func clipDuration(task VideoTask, metadata *VideoMetadata) float64 {
+	if task.Duration > 0 {
+		return task.Duration
+	}
+	return metadata.Duration - task.Start
+}
@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// LoudnormConfig normalizes the audio loudness with ffmpeg's loudnorm filter (EBU R128)
+type LoudnormConfig struct {
+	// TargetLUFS is the integrated loudness target, between -70 and -5 (e.g. -23 for broadcast, -16 for streaming)
+	TargetLUFS float64
+	// TwoPass measures each audio input first and feeds the measurements to the encode, for a linear,
+	// more accurate normalization at the cost of an extra decode of the audio
+	TwoPass bool
+}
+
+// loudnessMeasurement is the summary loudnorm prints with print_format=json
+type loudnessMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// filter returns the loudnorm filter for one audio stream; measured is nil for single-pass normalization.
+// loudnorm works at 192 kHz, so the result is resampled back to 48 kHz for AAC.
+func (c LoudnormConfig) filter(measured *loudnessMeasurement) string {
+	filter := c.target()
+	if measured != nil {
+		filter += fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+	}
+	return filter + ",aresample=48000"
+}
+
+func (c LoudnormConfig) target() string {
+	return "loudnorm=I=" + strconv.FormatFloat(c.TargetLUFS, 'f', -1, 64)
+}
+
+// audioSources lists the input streams that become the audio of the DASH output, in output order
+func audioSources(opts EncodeOptions) []string {
+	if len(opts.AudioTracks) == 0 {
+		return []string{"0:a:0"}
+	}
+	sources := make([]string, len(opts.AudioTracks))
+	for i := range opts.AudioTracks {
+		sources[i] = strconv.Itoa(i+1) + ":a:0"
+	}
+	return sources
+}
+
+// buildLoudnessArgs assembles the measuring pass of a two-pass normalization for one audio source.
+// loudnorm prints its summary at the info level, so the configured log level is not applied.
+func buildLoudnessArgs(input, source string, opts EncodeOptions) []string {
+	args := []string{"-hide_banner", "-nostats", "-loglevel", "info"}
+	args = append(args, inputArgs(input, opts)...)
+	return append(args,
+		"-map", source,
+		"-af", opts.Loudnorm.target()+":print_format=json",
+		"-f", "null", os.DevNull,
+	)
+}
+
+// parseLoudness extracts the JSON summary printed at the end of the measuring pass
+func parseLoudness(output []byte) (*loudnessMeasurement, error) {
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("loudnorm printed no measurements")
+	}
+	var measured loudnessMeasurement
+	if err := json.Unmarshal(output[start:end+1], &measured); err != nil {
+		return nil, fmt.Errorf("invalid loudnorm measurements: %v", err)
+	}
+	return &measured, nil
+}
+
+// loudnormArgs applies the normalization to each audio stream of the output, with the measured values
+// of its source after a measuring pass
+func loudnormArgs(opts EncodeOptions) []string {
+	if opts.Loudnorm == nil {
+		return nil
+	}
+	if len(opts.loudness) == 0 {
+		return []string{"-filter:a", opts.Loudnorm.filter(nil)}
+	}
+
+	var args []string
+	for i, measured := range opts.loudness {
+		args = append(args, "-filter:a:"+strconv.Itoa(i), opts.Loudnorm.filter(measured))
+	}
+	return args
+}
@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// mpdManifest is the part of an MPD document needed to check it references any media
+type mpdManifest struct {
+	XMLName xml.Name
+	Periods []struct {
+		AdaptationSets []struct {
+			Representations []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+	// MediaPresentationDuration is an ISO 8601 duration such as PT1M2.5S
+	MediaPresentationDuration string `xml:"mediaPresentationDuration,attr"`
+}
+
+// checkManifest verifies the file exists, is non-empty, parses as an MPD document and has at least one
+// representation; ffmpeg has been seen exiting successfully with empty or broken manifests
+func checkManifest(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w: manifest not produced: %v", ErrInvalidManifest, err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%w: manifest %s is empty", ErrInvalidManifest, path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: failed to open manifest: %v", ErrInvalidManifest, err)
+	}
+	defer file.Close()
+
+	var manifest mpdManifest
+	if err := xml.NewDecoder(file).Decode(&manifest); err != nil {
+		return fmt.Errorf("%w: manifest is not valid XML: %v", ErrInvalidManifest, err)
+	}
+	if manifest.XMLName.Local != "MPD" {
+		return fmt.Errorf("%w: manifest root is %q, expected MPD", ErrInvalidManifest, manifest.XMLName.Local)
+	}
+
+	for _, period := range manifest.Periods {
+		for _, set := range period.AdaptationSets {
+			if len(set.Representations) > 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: manifest %s has no representations", ErrInvalidManifest, path)
+}
+
+// isoDuration matches the PT#H#M#S durations ffmpeg writes in MPD manifests
+var isoDuration = regexp.MustCompile(`^PT(?:([\d.]+)H)?(?:([\d.]+)M)?(?:([\d.]+)S)?$`)
+
+// parseISODuration converts a PT#H#M#S duration to seconds, 0 when it doesn't match
+func parseISODuration(duration string) float64 {
+	parts := isoDuration.FindStringSubmatch(duration)
+	if parts == nil {
+		return 0
+	}
+	var seconds float64
+	for i, unit := range []float64{3600, 60, 1} {
+		value, _ := strconv.ParseFloat(parts[i+1], 64)
+		seconds += value * unit
+	}
+	return seconds
+}
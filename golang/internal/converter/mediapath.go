@@ -0,0 +1,46 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// normalizeMediaPath cleans the task path, resolves relative paths against the media root and follows
+// symlinks, rejecting paths that end up outside the root. With an empty root only the cleanup and
+// symlink resolution apply.
+func normalizeMediaPath(path, root string) (string, error) {
+	if !filepath.IsAbs(path) && root != "" {
+		path = filepath.Join(root, path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid path %s: %v", ErrInputRejected, path, err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: path %s is not accessible: %v", ErrInputRejected, path, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("%w: path %s is not accessible: %v", ErrInputRejected, path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%w: path %s is not a directory", ErrInputRejected, path)
+	}
+
+	if root == "" {
+		return resolved, nil
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("media root %s is not accessible: %v", root, err)
+	}
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: path %s resolves outside the media root %s", ErrInputRejected, path, root)
+	}
+	return resolved, nil
+}
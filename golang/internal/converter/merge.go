@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Merge strategies: byte concatenation for raw segments of one stream, or ffmpeg's concat demuxer for
+// chunks that are complete media files on their own
+const (
+	MergeStrategyBytes  = "bytes"
+	MergeStrategyConcat = "concat"
+)
+
+func validMergeStrategy(strategy string) bool {
+	return strategy == "" || strategy == MergeStrategyBytes || strategy == MergeStrategyConcat
+}
+
+// mergeStrategy returns the task's merge strategy, falling back to the configured default
+func (vc *VideoConverter) mergeStrategy(task VideoTask) string {
+	if task.MergeStrategy != "" {
+		return task.MergeStrategy
+	}
+	if vc.cfg.MergeStrategy != "" {
+		return vc.cfg.MergeStrategy
+	}
+	return MergeStrategyBytes
+}
+
+// concatChunks remuxes the chunks into outputFile with ffmpeg's concat demuxer, without re-encoding. The
+// list file is written next to outputFile and removed afterwards.
+func (vc *VideoConverter) concatChunks(ctx context.Context, chunks []string, outputFile string) error {
+	if vc.cfg.MaxMergedBytes > 0 {
+		var total int64
+		for _, chunk := range chunks {
+			info, err := os.Stat(chunk)
+			if err != nil {
+				return fmt.Errorf("failed to stat chunk %s: %v", chunk, err)
+			}
+			total += info.Size()
+		}
+		if total > vc.cfg.MaxMergedBytes {
+			return fmt.Errorf("%w: chunks add up to %d bytes, over the limit of %d bytes", ErrInputRejected, total, vc.cfg.MaxMergedBytes)
+		}
+	}
+
+	var list strings.Builder
+	for _, chunk := range chunks {
+		// aspas simples escapadas como '\'' no formato do concat demuxer
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(chunk, "'", `'\''`))
+	}
+	listFile := filepath.Join(filepath.Dir(outputFile), "concat.txt")
+	if err := os.WriteFile(listFile, []byte(list.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write concat list: %v", err)
+	}
+	defer os.Remove(listFile)
+
+	// -safe 0: a lista usa caminhos absolutos
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", listFile, "-c", "copy", outputFile}
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputFile)
+		return &FFmpegError{Args: args, Output: string(out), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SaveMetadata stores the probed metadata of a video, replacing any previous probe
+func SaveMetadata(ctx context.Context, db *sql.DB, videoID int, meta *VideoMetadata) error {
+	query := `INSERT INTO video_metadata (video_id, duration, size, bit_rate, video_codec, audio_codec, width, height, probed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (video_id) DO UPDATE SET duration = EXCLUDED.duration, size = EXCLUDED.size, bit_rate = EXCLUDED.bit_rate,
+			video_codec = EXCLUDED.video_codec, audio_codec = EXCLUDED.audio_codec, width = EXCLUDED.width,
+			height = EXCLUDED.height, probed_at = EXCLUDED.probed_at`
+	_, err := db.ExecContext(ctx, query, videoID, meta.Duration, meta.Size, meta.BitRate, meta.VideoCodec, meta.AudioCodec, meta.Width, meta.Height, time.Now())
+	return dbError(err)
+}
+
+// LoadMetadata returns the last probed metadata of a video
+func LoadMetadata(ctx context.Context, db *sql.DB, videoID int) (*VideoMetadata, error) {
+	var meta VideoMetadata
+	query := "SELECT duration, size, bit_rate, video_codec, audio_codec, width, height FROM video_metadata WHERE video_id = $1"
+	err := db.QueryRowContext(ctx, query, videoID).Scan(&meta.Duration, &meta.Size, &meta.BitRate, &meta.VideoCodec, &meta.AudioCodec, &meta.Width, &meta.Height)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return &meta, nil
+}
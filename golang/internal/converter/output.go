@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultOutputSubdir keeps each video's manifest in its own directory so tasks sharing a path don't collide
+const DefaultOutputSubdir = "mpeg-dash/{{.VideoID}}"
+
+// OutputFields are the values available to the output directory template
+type OutputFields struct {
+	VideoID int
+	// Date is the conversion day in UTC, formatted as 2006-01-02
+	Date string
+	// Path is the normalized task path
+	Path    string
+	Profile string
+}
+
+// outputFuncs lets templates pick apart the task path, e.g. {{base .Path}} for an upload id
+var outputFuncs = template.FuncMap{
+	"base": filepath.Base,
+	"dir":  filepath.Dir,
+}
+
+// parseOutputTemplate parses the output directory template. The legacy {video_id} placeholder is
+// still accepted.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultOutputSubdir
+	}
+	text = strings.ReplaceAll(text, "{video_id}", "{{.VideoID}}")
+	return template.New("output").Funcs(outputFuncs).Option("missingkey=error").Parse(text)
+}
+
+// outputDir evaluates the output template for the task. A relative result is inside the task path; an
+// absolute one must be inside the media root. It returns the absolute output directory and, for the work
+// dir, the same directory relative to the task path (or a fixed name when the output is elsewhere).
+func (vc *VideoConverter) outputDir(task *VideoTask) (outputPath, workSubdir string, err error) {
+	tmpl, err := parseOutputTemplate(vc.cfg.OutputSubdir)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid output template: %v", err)
+	}
+
+	var rendered strings.Builder
+	fields := OutputFields{
+		VideoID: task.VideoId,
+		Date:    time.Now().UTC().Format("2006-01-02"),
+		Path:    task.Path,
+		Profile: task.Profile,
+	}
+	if err := tmpl.Execute(&rendered, fields); err != nil {
+		return "", "", fmt.Errorf("failed to render output template: %v", err)
+	}
+
+	dir := filepath.Clean(rendered.String())
+	if !filepath.IsAbs(dir) {
+		if !insideDir(task.Path, filepath.Join(task.Path, dir)) {
+			return "", "", fmt.Errorf("output dir %q must stay inside the task path", dir)
+		}
+		return filepath.Join(task.Path, dir), dir, nil
+	}
+
+	if vc.cfg.MediaRoot == "" || !insideDir(vc.cfg.MediaRoot, dir) {
+		return "", "", fmt.Errorf("output dir %q must stay inside the media root", dir)
+	}
+	return dir, "mpeg-dash", nil
+}
+
+// insideDir reports whether path is strictly below root
+func insideDir(root, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// PostProcessor is a custom step run after a successful DASH encode (e.g. hashing, sprite sheets).
+// Returning an error fails the whole conversion.
+type PostProcessor interface {
+	Name() string
+	Process(ctx context.Context, task VideoTask, outputDir string) error
+}
+
+// NewPostProcessor returns the built-in post-processor with the given name, for POST_PROCESSORS
+func NewPostProcessor(name string) (PostProcessor, error) {
+	switch name {
+	case "manifest_validator":
+		return ManifestValidator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown post-processor %q", name)
+	}
+}
+
+// ParsePostProcessors builds the chain from a comma-separated list of names, keeping their order
+func ParsePostProcessors(names string) ([]PostProcessor, error) {
+	var chain []PostProcessor
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		processor, err := NewPostProcessor(name)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, processor)
+	}
+	return chain, nil
+}
+
+// runPostProcessors runs the configured chain in order, stopping at the first failure
+func (vc *VideoConverter) runPostProcessors(ctx context.Context, task VideoTask, outputDir string) error {
+	for _, processor := range vc.cfg.PostProcessors {
+		if err := processor.Process(ctx, task, outputDir); err != nil {
+			return fmt.Errorf("post-processor %s failed: %w", processor.Name(), err)
+		}
+		slog.Info("Post-processor finished", slog.Int("video_id", task.VideoId), slog.String("post_processor", processor.Name()))
+	}
+	return nil
+}
+
+// ManifestValidator checks that output.mpd is a valid MPD document. processVideo already validates the
+// manifest it produces; the processor is useful when a later step rewrites it.
+type ManifestValidator struct{}
+
+func (ManifestValidator) Name() string {
+	return "manifest_validator"
+}
+
+func (ManifestValidator) Process(ctx context.Context, task VideoTask, outputDir string) error {
+	return checkManifest(filepath.Join(outputDir, "output.mpd"))
+}
@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Preview formats
+const (
+	PreviewFormatGIF = "gif"
+	PreviewFormatMP4 = "mp4"
+)
+
+// PreviewConfig controls the short looping preview generated next to the DASH output
+type PreviewConfig struct {
+	Format  string  // gif ou mp4 (sem audio)
+	Start   float64 // em segundos; negativo centraliza o trecho no meio do video
+	Seconds float64
+	FPS     int
+	Width   int
+}
+
+// generatePreview writes preview.gif or preview.mp4 into outputDir and returns its path
+// offset shifts the preview into a clip that starts offset seconds into input
+func generatePreview(ctx context.Context, input, outputDir string, offset, duration float64, cfg PreviewConfig) (string, error) {
+	start := cfg.Start
+	if start < 0 {
+		start = (duration - cfg.Seconds) / 2
+	}
+	if start < 0 {
+		start = 0
+	}
+	start += offset
+
+	filter := "fps=" + strconv.Itoa(cfg.FPS) + ",scale=" + strconv.Itoa(cfg.Width) + ":-2:flags=lanczos"
+	args := []string{
+		"-y",
+		"-ss", strconv.FormatFloat(start, 'f', 2, 64),
+		"-t", strconv.FormatFloat(cfg.Seconds, 'f', 2, 64),
+		"-i", input,
+		"-an",
+	}
+
+	var output string
+	switch cfg.Format {
+	case PreviewFormatGIF:
+		output = filepath.Join(outputDir, "preview.gif")
+		// paleta gerada a partir do proprio trecho para um gif com cores melhores
+		args = append(args, "-vf", filter+",split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse", "-loop", "0", output)
+	case PreviewFormatMP4:
+		output = filepath.Join(outputDir, "preview.mp4")
+		args = append(args, "-vf", filter, "-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart", output)
+	default:
+		return "", fmt.Errorf("unsupported preview format %q", cfg.Format)
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", &FFmpegError{Args: args, Output: string(out), Err: err}
+	}
+	return output, nil
+}
+
+// createPreview generates the preview for the task when enabled. A failed preview doesn't fail the conversion.
+func (vc *VideoConverter) createPreview(ctx context.Context, task *VideoTask, input string, metadata *VideoMetadata) string {
+	if !vc.cfg.Features.Previews {
+		return ""
+	}
+
+	preview, err := generatePreview(ctx, input, task.Path, task.Start, clipDuration(*task, metadata), vc.cfg.Preview)
+	if err != nil {
+		slog.Warn("Failed to generate preview", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		return ""
+	}
+	slog.Info("Generated preview", slog.Int("video_id", task.VideoId), slog.String("file", preview))
+	return preview
+}
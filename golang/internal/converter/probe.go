@@ -0,0 +1,80 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// VideoMetadata is the information ffprobe reports about a media file
+type VideoMetadata struct {
+	Duration   float64 `json:"duration"` // em segundos
+	Size       int64   `json:"size"`
+	BitRate    int64   `json:"bit_rate"`
+	VideoCodec string  `json:"video_codec"`
+	AudioCodec string  `json:"audio_codec"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+}
+
+// ffprobeOutput mirrors the parts of `ffprobe -print_format json` we use
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+		Size     string `json:"size"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+}
+
+// Probe runs ffprobe on the file and returns its metadata
+func Probe(ctx context.Context, file string) (*VideoMetadata, error) {
+	cmd := exec.CommandContext(ctx, ffprobeBinary,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+		file,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	var probed ffprobeOutput
+	if err := json.Unmarshal(output, &probed); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	// campos numericos do format vem como string no json do ffprobe
+	metadata := &VideoMetadata{}
+	metadata.Duration, _ = strconv.ParseFloat(probed.Format.Duration, 64)
+	metadata.Size, _ = strconv.ParseInt(probed.Format.Size, 10, 64)
+	metadata.BitRate, _ = strconv.ParseInt(probed.Format.BitRate, 10, 64)
+
+	for _, stream := range probed.Streams {
+		switch stream.CodecType {
+		case "video":
+			if metadata.VideoCodec == "" {
+				metadata.VideoCodec = stream.CodecName
+				metadata.Width = stream.Width
+				metadata.Height = stream.Height
+			}
+		case "audio":
+			if metadata.AudioCodec == "" {
+				metadata.AudioCodec = stream.CodecName
+			}
+		}
+	}
+
+	if metadata.VideoCodec == "" {
+		return nil, fmt.Errorf("no video stream found in %s", file)
+	}
+	return metadata, nil
+}
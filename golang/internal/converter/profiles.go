@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rendition is one video quality of the DASH ladder
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height"`
+	VideoBitrate string `json:"video_bitrate"`
+}
+
+// scaleFilter resizes to the rendition height, keeping the aspect ratio unless a width is given
+func (r Rendition) scaleFilter() string {
+	width := "-2"
+	if r.Width > 0 {
+		width = strconv.Itoa(r.Width)
+	}
+	return "scale=" + width + ":" + strconv.Itoa(r.Height)
+}
+
+// Profile is a named set of renditions that tasks can reference instead of raw encode settings
+type Profile struct {
+	Renditions   []Rendition `json:"renditions"`
+	AudioBitrate string      `json:"audio_bitrate,omitempty"`
+	// TwoPass encodes with an analysis pass first; roughly doubles encode time
+	TwoPass bool `json:"two_pass,omitempty"`
+}
+
+// LoadProfiles reads the profiles file, a JSON object mapping profile names to their settings
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %v", err)
+	}
+
+	var profiles map[string]Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file: %v", err)
+	}
+
+	for name, profile := range profiles {
+		if len(profile.Renditions) == 0 {
+			return nil, fmt.Errorf("profile %s has no renditions", name)
+		}
+		for _, rendition := range profile.Renditions {
+			if rendition.Height <= 0 || rendition.VideoBitrate == "" {
+				return nil, fmt.Errorf("profile %s has a rendition without height or video_bitrate", name)
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// resolveProfile looks up the profile referenced by the task; an empty name means no profile
+func (vc *VideoConverter) resolveProfile(name string) (*Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	profile, ok := vc.cfg.Profiles[name]
+	if !ok {
+		valid := make([]string, 0, len(vc.cfg.Profiles))
+		for profileName := range vc.cfg.Profiles {
+			valid = append(valid, profileName)
+		}
+		sort.Strings(valid)
+		return nil, fmt.Errorf("%w: unknown profile %q, valid profiles: %s", ErrInputRejected, name, strings.Join(valid, ", "))
+	}
+	return &profile, nil
+}
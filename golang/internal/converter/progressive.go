@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+)
+
+// generateProgressiveMP4 writes a single-quality output.mp4 into outputDir with the moov atom up front,
+// so it can be played while downloading. height 0 keeps the source resolution.
+func generateProgressiveMP4(ctx context.Context, input, outputDir string, clip []string, height int) (string, error) {
+	output := filepath.Join(outputDir, "output.mp4")
+	args := append([]string{"-y"}, clip...)
+	args = append(args, "-i", input, "-map", "0:v:0", "-map", "0:a:0?")
+	if height > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", height))
+	}
+	args = append(args,
+		"-c:v", "libx264", "-preset", "medium", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		output,
+	)
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", &FFmpegError{Args: args, Output: string(out), Err: err}
+	}
+	return output, nil
+}
+
+// createProgressiveMP4 encodes output.mp4 next to the DASH output when enabled. Consumers rely on the
+// download link in the confirmation, so unlike previews a failure fails the conversion.
+func (vc *VideoConverter) createProgressiveMP4(ctx context.Context, task *VideoTask, input, outputDir string) (bool, error) {
+	if !vc.cfg.Features.ProgressiveMP4 {
+		return false, nil
+	}
+
+	clip := clipArgs(EncodeOptions{Start: task.Start, Duration: task.Duration})
+	output, err := generateProgressiveMP4(ctx, input, outputDir, clip, vc.cfg.ProgressiveHeight)
+	if err != nil {
+		return false, fmt.Errorf("failed to generate progressive MP4: %w", err)
+	}
+	slog.Info("Generated progressive MP4", slog.Int("video_id", task.VideoId), slog.String("file", output))
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// quarantineFiles lists the inputs and intermediates of a failed task that still exist. The DASH output is
+// left alone: it may belong to an earlier successful conversion that is being served.
+func (vc *VideoConverter) quarantineFiles(task VideoTask) []string {
+	files, _ := vc.taskChunks(task)
+	for _, name := range []string{"merged.mp4", "ffmpeg.log"} {
+		files = append(files, filepath.Join(task.Path, name))
+	}
+
+	var existing []string
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+// quarantine moves the files of a permanently failed task to QuarantineDir/<video_id>/<timestamp>, keeping
+// their paths relative to the task path, and records the move in the error log. It's a no-op unless
+// Features.Quarantine is set.
+func (vc *VideoConverter) quarantine(task VideoTask, cause error) {
+	if !vc.cfg.Features.Quarantine || isRemotePath(task.Path) {
+		return
+	}
+	files := vc.quarantineFiles(task)
+	if len(files) == 0 {
+		return
+	}
+
+	dir := filepath.Join(vc.cfg.QuarantineDir, strconv.Itoa(task.VideoId), time.Now().UTC().Format("20060102T150405Z"))
+	moved := 0
+	for _, file := range files {
+		rel, err := filepath.Rel(task.Path, file)
+		if err != nil {
+			rel = filepath.Base(file)
+		}
+		if err := moveFile(file, filepath.Join(dir, rel)); err != nil {
+			slog.Warn("Failed to quarantine file", slog.Int("video_id", task.VideoId), slog.String("file", file), slog.String("error", err.Error()))
+			continue
+		}
+		moved++
+	}
+	if moved == 0 {
+		return
+	}
+	slog.Info("Moved failed input to quarantine", slog.Int("video_id", task.VideoId), slog.String("dir", dir), slog.Int("files", moved))
+
+	ctx, cancel := vc.dbContext(context.Background())
+	defer cancel()
+	RegisterError(ctx, vc.db, map[string]any{
+		"video_id":   task.VideoId,
+		"error":      "Failed input moved to quarantine",
+		"details":    cause.Error(),
+		"kind":       ErrorKind(cause),
+		"quarantine": dir,
+		"files":      moved,
+		"time":       time.Now(),
+	}, cause)
+}
+
+// moveFile renames src to dst, creating dst's directory, and falls back to copy and remove across filesystems
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create quarantine dir: %v", err)
+	}
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/streadway/amqp"
+)
+
+// settleTracker wraps the Acknowledger of a delivery to record whether it was already acked, nacked or
+// rejected, so a panic after that point doesn't settle the delivery a second time
+type settleTracker struct {
+	amqp.Acknowledger
+	settled bool
+}
+
+func (t *settleTracker) Ack(tag uint64, multiple bool) error {
+	t.settled = true
+	return t.Acknowledger.Ack(tag, multiple)
+}
+
+func (t *settleTracker) Nack(tag uint64, multiple, requeue bool) error {
+	t.settled = true
+	return t.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (t *settleTracker) Reject(tag uint64, requeue bool) error {
+	t.settled = true
+	return t.Acknowledger.Reject(tag, requeue)
+}
+
+// recoverPanic turns a panic while handling a delivery into a registered error and a dead-lettered
+// message, so one bad video doesn't take down the other conversions running in this worker. A delivery
+// that was settled before the panic is only logged: settling it again would close the channel.
+func (vc *VideoConverter) recoverPanic(d amqp.Delivery, settled bool, recovered any) {
+	// melhor esforco para descobrir o video_id da mensagem
+	var task VideoTask
+	_ = json.Unmarshal(d.Body, &task)
+
+	slog.Error("Recovered from panic while handling message",
+		slog.Int("video_id", task.VideoId),
+		slog.Any("panic", recovered),
+		slog.String("stack", string(debug.Stack())))
+
+	if settled {
+		vc.logError(task, "Panic after the message was settled", fmt.Errorf("panic: %v", recovered))
+		return
+	}
+
+	vc.deadLetter(d, task, "Panic while handling message", fmt.Errorf("panic: %v", recovered))
+}
@@ -0,0 +1,117 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isRemotePath reports whether the task path points at an already assembled source file
+// (http(s):// or s3://) instead of a local chunk directory
+func isRemotePath(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "s3://")
+}
+
+// prepareRemoteTask moves the URL to SourceURL and points Path at a local directory under the media root,
+// where subtitles, previews and the DASH output are written as for chunked uploads
+func (vc *VideoConverter) prepareRemoteTask(task *VideoTask) error {
+	if vc.cfg.MediaRoot == "" {
+		return fmt.Errorf("MEDIA_ROOT is required to convert remote sources")
+	}
+
+	task.SourceURL = task.Path
+	task.Path = filepath.Join(vc.cfg.MediaRoot, strconv.Itoa(task.VideoId))
+	if err := os.MkdirAll(task.Path, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create local directory for remote source: %v", err)
+	}
+	return nil
+}
+
+// sourceHTTPURL maps s3://bucket/key to <S3Endpoint>/bucket/key (path-style, works with MinIO);
+// private objects must be exposed through presigned http(s) URLs instead. Keys are stored unescaped
+// (e.g. from S3 events), so each path segment is escaped here.
+func (vc *VideoConverter) sourceHTTPURL(source string) (string, error) {
+	if !strings.HasPrefix(source, "s3://") {
+		return source, nil
+	}
+	if vc.cfg.S3Endpoint == "" {
+		return "", fmt.Errorf("S3_ENDPOINT is required for s3:// sources")
+	}
+
+	segments := strings.Split(strings.TrimPrefix(source, "s3://"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(vc.cfg.S3Endpoint, "/") + "/" + strings.Join(segments, "/"), nil
+}
+
+// downloadSource streams the remote source into dest
+func (vc *VideoConverter) downloadSource(ctx context.Context, source, dest string) error {
+	sourceURL, err := vc.sourceHTTPURL(source)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build download request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download source: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("download of %s returned status %d", redactURL(sourceURL), resp.StatusCode)
+		// 4xx (fora timeout e rate limit) nao muda numa nova entrega: URL expirada, objeto inexistente...
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %v", ErrInputRejected, err)
+		}
+		return err
+	}
+	if vc.cfg.MaxInputBytes > 0 && resp.ContentLength > vc.cfg.MaxInputBytes {
+		return fmt.Errorf("%w: source is %d bytes, over the limit of %d bytes", ErrInputRejected, resp.ContentLength, vc.cfg.MaxInputBytes)
+	}
+
+	output, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create source file: %v", err)
+	}
+	defer output.Close()
+
+	// Content-Length can be missing or wrong, so the body is cut one byte past the limit
+	body := io.Reader(resp.Body)
+	if vc.cfg.MaxInputBytes > 0 {
+		body = io.LimitReader(resp.Body, vc.cfg.MaxInputBytes+1)
+	}
+	written, err := io.Copy(output, body)
+	if err != nil {
+		return fmt.Errorf("failed to download source: %v", err)
+	}
+	if vc.cfg.MaxInputBytes > 0 && written > vc.cfg.MaxInputBytes {
+		os.Remove(dest)
+		return fmt.Errorf("%w: source exceeds the limit of %d bytes", ErrInputRejected, vc.cfg.MaxInputBytes)
+	}
+	slog.Info("Downloaded remote source", slog.String("url", redactURL(sourceURL)), slog.Int64("bytes", written))
+	return nil
+}
+
+// redactURL drops the query string, which carries the signature of presigned URLs
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	parsed.RawQuery = ""
+	return parsed.String()
+}
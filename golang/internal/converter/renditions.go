@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// renditionDirPrefix names the directory of each representation in the per_rendition layout, followed by the
+// representation id ffmpeg assigns in output order (video renditions first, then audio and subtitles)
+const renditionDirPrefix = "stream"
+
+// perRenditionArgs points the init and media segments of every representation into its own directory,
+// so output.mpd becomes a master manifest over independently cacheable file sets
+func perRenditionArgs(opts EncodeOptions) []string {
+	if !opts.PerRendition {
+		return nil
+	}
+	dir := renditionDirPrefix + "$RepresentationID$/"
+	return []string{
+		"-init_seg_name", dir + "init.$ext$",
+		"-media_seg_name", dir + "chunk-$Number%05d$.$ext$",
+	}
+}
+
+// maxRepresentations is an upper bound on the representations the encode produces; with ffmpeg's default
+// stream selection that's one video and one audio stream
+func maxRepresentations(opts EncodeOptions) int {
+	return max(len(opts.Renditions), 1) + max(len(opts.AudioTracks), 1) + len(opts.Subtitles)
+}
+
+// prepareRenditionDirs creates a directory for every representation the encode may write, since the dash
+// muxer doesn't create the directories in segment names. The ones left empty are removed afterwards.
+func prepareRenditionDirs(outputDir string, opts EncodeOptions) (cleanup func(), err error) {
+	var dirs []string
+	for i := range maxRepresentations(opts) {
+		dir := filepath.Join(outputDir, renditionDirPrefix+strconv.Itoa(i))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to create rendition directory: %v", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	return func() {
+		for _, dir := range dirs {
+			// so remove diretorios vazios
+			os.Remove(dir)
+		}
+	}, nil
+}
+
+// renditionDirs maps each video rendition to its directory inside outputPath in the per_rendition layout
+func renditionDirs(outputPath string, renditions []Rendition) map[string]string {
+	if len(renditions) == 0 {
+		return nil
+	}
+	dirs := make(map[string]string, len(renditions))
+	for i, rendition := range renditions {
+		dirs[rendition.Name] = filepath.Join(outputPath, renditionDirPrefix+strconv.Itoa(i))
+	}
+	return dirs
+}
+
+// dashLayout returns the configured DASH layout or the default
+func (vc *VideoConverter) dashLayout() string {
+	if vc.cfg.DashLayout != "" {
+		return vc.cfg.DashLayout
+	}
+	return DashLayoutSegmented
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ProcessedResult returns the content hash and the full result stored by the last successful conversion
+// of the video; result is nil when none was stored
+func ProcessedResult(ctx context.Context, db *sql.DB, videoID int) (contentHash string, result *ConversionResult, err error) {
+	query := "SELECT COALESCE(content_hash, ''), result FROM processed_videos WHERE video_id = $1 AND result IS NOT NULL"
+
+	var payload []byte
+	err = db.QueryRowContext(ctx, query, videoID).Scan(&contentHash, &payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, dbError(err)
+	}
+	result = &ConversionResult{}
+	if err := json.Unmarshal(payload, result); err != nil {
+		return "", nil, err
+	}
+	return contentHash, result, nil
+}
+
+// existingOutput returns the stored result of a valid DASH output already in outputPath, so a redelivery
+// that slipped past the idempotency checks re-emits the confirmation instead of overwriting output that
+// may be serving players. Output is only reused when it was converted from the same content (contentHash)
+// and its full result (renditions, encryption, checksums) was stored; ok is false otherwise.
+func (vc *VideoConverter) existingOutput(ctx context.Context, task *VideoTask, outputPath, contentHash string) (*ConversionResult, bool) {
+	if vc.db == nil {
+		return nil, false
+	}
+	manifest := filepath.Join(outputPath, "output.mpd")
+	if err := checkManifest(manifest); err != nil {
+		return nil, false
+	}
+
+	dbCtx, cancel := vc.dbContext(ctx)
+	defer cancel()
+	storedHash, result, err := ProcessedResult(dbCtx, vc.db, task.VideoId)
+	if err != nil {
+		slog.Warn("Failed to load stored result", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		return nil, false
+	}
+	// um re-upload com conteudo novo e convertido de novo
+	if result == nil || storedHash != contentHash || result.ManifestPath != manifest {
+		return nil, false
+	}
+	if result.Checksums != "" && !exists(result.Checksums) {
+		return nil, false
+	}
+	return result, true
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// S3Event is the notification S3 and MinIO send for bucket events (only the fields used here).
+//
+// Object keys map to tasks by convention: the object's parent directory is the video id, so
+// "uploads/42/source.mp4" in bucket "media" becomes {"video_id": 42, "path": "s3://media/uploads/42/source.mp4"}.
+// The object is downloaded through S3_ENDPOINT like any other s3:// source. Keys whose parent directory
+// isn't a positive integer are rejected.
+type S3Event struct {
+	Records []S3EventRecord `json:"Records"`
+}
+
+type S3EventRecord struct {
+	EventName string `json:"eventName"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// isS3Event reports whether the message body is an S3 event notification instead of a native task
+func isS3Event(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return false
+	}
+	_, hasRecords := fields["Records"]
+	return hasRecords
+}
+
+// created reports whether the record is an upload; S3 names it "ObjectCreated:Put", MinIO "s3:ObjectCreated:Put"
+func (r S3EventRecord) created() bool {
+	return strings.HasPrefix(strings.TrimPrefix(r.EventName, "s3:"), "ObjectCreated:")
+}
+
+// task maps the record's object to a VideoTask following the key convention of S3Event
+func (r S3EventRecord) task() (VideoTask, error) {
+	// as chaves chegam url-encoded nas notificacoes (espaco vira +)
+	key, err := url.QueryUnescape(r.S3.Object.Key)
+	if err != nil {
+		return VideoTask{}, fmt.Errorf("invalid object key %q: %v", r.S3.Object.Key, err)
+	}
+	if r.S3.Bucket.Name == "" || key == "" {
+		return VideoTask{}, fmt.Errorf("event record has no bucket or object key")
+	}
+
+	videoID, err := strconv.Atoi(path.Base(path.Dir(key)))
+	if err != nil || videoID <= 0 {
+		return VideoTask{}, fmt.Errorf("object key %q is not under a video id directory, expected <prefix>/<video_id>/<file>", key)
+	}
+	return VideoTask{VideoId: videoID, Path: "s3://" + r.S3.Bucket.Name + "/" + key}, nil
+}
+
+// parseS3Event returns a task per ObjectCreated record; other events (removals, restores) are ignored
+func parseS3Event(body []byte) ([]VideoTask, error) {
+	var event S3Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+
+	var tasks []VideoTask
+	for _, record := range event.Records {
+		if !record.created() {
+			continue
+		}
+		task, err := record.task()
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
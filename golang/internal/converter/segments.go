@@ -0,0 +1,169 @@
+package converter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// segmentTemplate is an MPD SegmentTemplate, with the SegmentTimeline ffmpeg writes by default
+type segmentTemplate struct {
+	Initialization string `xml:"initialization,attr"`
+	Media          string `xml:"media,attr"`
+	StartNumber    *int   `xml:"startNumber,attr"`
+	Timescale      int64  `xml:"timescale,attr"`
+	Duration       int64  `xml:"duration,attr"`
+	Timeline       *struct {
+		Segments []struct {
+			T *int64 `xml:"t,attr"`
+			D int64  `xml:"d,attr"`
+			R int    `xml:"r,attr"`
+		} `xml:"S"`
+	} `xml:"SegmentTimeline"`
+}
+
+// segmentManifest is the part of an MPD document that says which files it references
+type segmentManifest struct {
+	Periods []struct {
+		AdaptationSets []struct {
+			Template        *segmentTemplate `xml:"SegmentTemplate"`
+			Representations []struct {
+				ID        string           `xml:"id,attr"`
+				Bandwidth string           `xml:"bandwidth,attr"`
+				BaseURL   string           `xml:"BaseURL"`
+				Template  *segmentTemplate `xml:"SegmentTemplate"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+	MediaPresentationDuration string `xml:"mediaPresentationDuration,attr"`
+}
+
+// templateIdentifier matches the $Identifier$ and $Identifier%0Nd$ placeholders of a SegmentTemplate
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0\d+d)?\$`)
+
+// expandTemplate fills a SegmentTemplate URL for one segment
+func expandTemplate(tmpl, representationID, bandwidth string, number int, time int64) string {
+	expanded := templateIdentifier.ReplaceAllStringFunc(tmpl, func(match string) string {
+		parts := templateIdentifier.FindStringSubmatch(match)
+		format := "%d"
+		if parts[2] != "" {
+			format = parts[2]
+		}
+		switch parts[1] {
+		case "RepresentationID":
+			return representationID
+		case "Bandwidth":
+			return bandwidth
+		case "Number":
+			return fmt.Sprintf(format, number)
+		default:
+			return fmt.Sprintf(format, time)
+		}
+	})
+	return strings.ReplaceAll(expanded, "$$", "$")
+}
+
+// segmentFiles lists the media segments a template references, given the presentation duration for
+// templates without a timeline
+func segmentFiles(tmpl *segmentTemplate, representationID, bandwidth string, duration float64) []string {
+	if tmpl.Media == "" {
+		return nil
+	}
+	number := 1
+	if tmpl.StartNumber != nil {
+		number = *tmpl.StartNumber
+	}
+
+	var files []string
+	if tmpl.Timeline != nil {
+		var time int64
+		for _, s := range tmpl.Timeline.Segments {
+			if s.T != nil {
+				time = *s.T
+			}
+			// r negativo (repetir ate o fim) nao e escrito pelo ffmpeg; conta como um segmento
+			for i := 0; i <= max(s.R, 0); i++ {
+				files = append(files, expandTemplate(tmpl.Media, representationID, bandwidth, number, time))
+				number++
+				time += s.D
+			}
+		}
+		return files
+	}
+
+	if tmpl.Duration <= 0 || duration <= 0 {
+		return nil
+	}
+	timescale := max(tmpl.Timescale, 1)
+	count := int(math.Ceil(duration * float64(timescale) / float64(tmpl.Duration)))
+	for i := 0; i < count; i++ {
+		files = append(files, expandTemplate(tmpl.Media, representationID, bandwidth, number+i, int64(i)*tmpl.Duration))
+	}
+	return files
+}
+
+// manifestFiles lists every file, relative to the manifest directory, a valid manifest references:
+// init and media segments of each representation, or its BaseURL in single-file outputs
+func manifestFiles(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var manifest segmentManifest
+	if err := xml.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	duration := parseISODuration(manifest.MediaPresentationDuration)
+
+	var files []string
+	for _, period := range manifest.Periods {
+		for _, set := range period.AdaptationSets {
+			for _, rep := range set.Representations {
+				if rep.BaseURL != "" {
+					files = append(files, strings.TrimSpace(rep.BaseURL))
+				}
+				tmpl := rep.Template
+				if tmpl == nil {
+					tmpl = set.Template
+				}
+				if tmpl == nil {
+					continue
+				}
+				if tmpl.Initialization != "" {
+					files = append(files, expandTemplate(tmpl.Initialization, rep.ID, rep.Bandwidth, 0, 0))
+				}
+				files = append(files, segmentFiles(tmpl, rep.ID, rep.Bandwidth, duration)...)
+			}
+		}
+	}
+	return files, nil
+}
+
+// checkSegments verifies every segment the manifest references exists with a non-zero size. A truncated
+// encode (full disk, killed ffmpeg) can leave a well-formed manifest pointing at segments never written.
+func checkSegments(manifest string) error {
+	files, err := manifestFiles(manifest)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read segments from manifest: %v", ErrInvalidManifest, err)
+	}
+
+	dir := filepath.Dir(manifest)
+	var missing []string
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || info.Size() == 0 {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %d of %d segments referenced by the manifest are missing or empty (first: %s)",
+			ErrInvalidManifest, len(missing), len(files), missing[0])
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// SelfTest generates a short synthetic video, converts it with the configured pipeline in a temporary
+// directory and checks that a valid MPD manifest comes out. It catches missing codecs or unwritable paths
+// before the worker takes real traffic.
+func (vc *VideoConverter) SelfTest(ctx context.Context) error {
+	dir, err := os.MkdirTemp("", "videoconverter-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create self-test directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// um unico chunk com o video inteiro; o merge so concatena os bytes
+	sample := filepath.Join(dir, "0.chunk")
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "testsrc=duration=2:size=320x240:rate=25",
+		"-f", "lavfi", "-i", "sine=frequency=440:duration=2",
+		"-c:v", "libx264", "-c:a", "aac", "-shortest", "-f", "mp4", sample,
+	}
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return &FFmpegError{Op: "failed to generate self-test sample", Args: args, Output: string(output), Err: err}
+	}
+
+	result, err := vc.ConvertDirectory(ctx, dir, ConvertOptions{ChunkPattern: DefaultChunkPattern})
+	if err != nil {
+		return fmt.Errorf("self-test conversion failed: %w", err)
+	}
+
+	manifest := filepath.Join(result.OutputPath, "output.mpd")
+	if err := checkManifest(manifest); err != nil {
+		return err
+	}
+	slog.Info("Self-test passed", slog.String("manifest", manifest))
+	return nil
+}
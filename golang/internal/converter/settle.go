@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// chunkSnapshot describes the chunks currently on disk (names and sizes), so two snapshots are equal
+// only when no chunk was added, removed or grew in between. Listed chunks that aren't there yet make
+// the snapshot incomplete: the error wraps ErrChunksMissing.
+func (vc *VideoConverter) chunkSnapshot(task VideoTask) (string, error) {
+	chunks, err := vc.taskChunks(task)
+	if errors.Is(err, ErrNoChunks) {
+		return "", nil
+	}
+	if errors.Is(err, ErrChunksMissing) {
+		return err.Error(), err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var snapshot strings.Builder
+	for _, chunk := range chunks {
+		info, err := os.Stat(chunk)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat chunk %s: %v", chunk, err)
+		}
+		fmt.Fprintf(&snapshot, "%s:%d;", chunk, info.Size())
+	}
+	return snapshot.String(), nil
+}
+
+// waitForChunks polls the task's chunks until they stay unchanged for ChunkSettleTime, so a conversion
+// message that arrives before the uploader flushed the last chunk doesn't merge a truncated video. After
+// ChunkSettleMax it gives up waiting and merges what is there. Chunks listed in the task or manifest.json
+// that are still missing by then fail the conversion with a retryable error, so a later delivery can
+// pick up the rest of the upload.
+func (vc *VideoConverter) waitForChunks(ctx context.Context, task VideoTask) error {
+	settle := vc.cfg.ChunkSettleTime
+	poll := min(settle/4, time.Second)
+	deadline := time.Now().Add(vc.cfg.ChunkSettleMax)
+
+	last, missing := vc.chunkSnapshot(task)
+	if missing != nil && !errors.Is(missing, ErrChunksMissing) {
+		return missing
+	}
+	stableSince := time.Now()
+	for missing != nil || time.Since(stableSince) < settle {
+		if time.Now().After(deadline) {
+			if missing != nil {
+				return fmt.Errorf("chunks still missing after %s: %w", vc.cfg.ChunkSettleMax, missing)
+			}
+			slog.Warn("Chunks still changing, merging anyway", slog.Int("video_id", task.VideoId),
+				slog.Duration("waited", vc.cfg.ChunkSettleMax))
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+
+		current, err := vc.chunkSnapshot(task)
+		if err != nil && !errors.Is(err, ErrChunksMissing) {
+			return err
+		}
+		missing = err
+		if current != last {
+			last = current
+			stableSince = time.Now()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package converter
+
+import "context"
+
+// workerSlots caps how many conversions run at once, shared by queue deliveries and RunTask callers
+type workerSlots chan struct{}
+
+// newWorkerSlots returns nil (no cap) when n is not positive
+func newWorkerSlots(n int) workerSlots {
+	if n <= 0 {
+		return nil
+	}
+	return make(workerSlots, n)
+}
+
+// Acquire blocks until a slot is free or ctx is canceled; a nil value never blocks
+func (s workerSlots) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (s workerSlots) Release() {
+	if s != nil {
+		<-s
+	}
+}
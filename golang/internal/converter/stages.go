@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Pipeline stages checkpointed in conversion_stages. The copy to the media path isn't one: a work dir
+// doesn't survive a failed attempt, and output already in the media path is reused by existingOutput.
+const (
+	StageMerge      = "merge"
+	StageProbe      = "probe"
+	StageEncode     = "encode"
+	StageThumbnails = "thumbnails"
+)
+
+// CompletedStages returns the stages a previous attempt completed for the same content
+func CompletedStages(ctx context.Context, db *sql.DB, videoID int, contentHash string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT stage FROM conversion_stages WHERE video_id = $1 AND content_hash = $2", videoID, contentHash)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	stages := make(map[string]bool)
+	for rows.Next() {
+		var stage string
+		if err := rows.Scan(&stage); err != nil {
+			return nil, err
+		}
+		stages[stage] = true
+	}
+	return stages, rows.Err()
+}
+
+// MarkStageCompleted records that a stage finished for the given content
+func MarkStageCompleted(ctx context.Context, db *sql.DB, videoID int, contentHash, stage string) error {
+	query := `INSERT INTO conversion_stages (video_id, stage, content_hash, completed_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (video_id, stage) DO UPDATE SET content_hash = EXCLUDED.content_hash, completed_at = EXCLUDED.completed_at`
+	_, err := db.ExecContext(ctx, query, videoID, stage, contentHash, time.Now())
+	return dbError(err)
+}
+
+// ClearStages forgets the checkpoints of a video, once it's converted or before a forced run
+func ClearStages(ctx context.Context, db *sql.DB, videoID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM conversion_stages WHERE video_id = $1", videoID)
+	return dbError(err)
+}
+
+// checkpoint tracks the completed stages of one conversion attempt. A nil checkpoint (no database, library
+// calls) never skips a stage and records nothing.
+type checkpoint struct {
+	vc          *VideoConverter
+	videoID     int
+	contentHash string
+	completed   map[string]bool
+}
+
+// loadCheckpoint reads the stages completed by earlier attempts. Forced runs start over, and a failed read
+// only costs redoing the work, so both return an empty checkpoint.
+func (vc *VideoConverter) loadCheckpoint(ctx context.Context, task VideoTask, contentHash string) *checkpoint {
+	if vc.db == nil {
+		return nil
+	}
+	cp := &checkpoint{vc: vc, videoID: task.VideoId, contentHash: contentHash, completed: map[string]bool{}}
+
+	dbCtx, cancel := vc.dbContext(ctx)
+	defer cancel()
+	if task.Force {
+		if err := ClearStages(dbCtx, vc.db, task.VideoId); err != nil {
+			slog.Warn("Failed to clear stage checkpoints", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		}
+		return cp
+	}
+	completed, err := CompletedStages(dbCtx, vc.db, task.VideoId, contentHash)
+	if err != nil {
+		slog.Warn("Failed to load stage checkpoints", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		return cp
+	}
+	cp.completed = completed
+	return cp
+}
+
+// resuming reports whether an earlier attempt completed any stage without finishing the conversion
+func (cp *checkpoint) resuming() bool {
+	return cp != nil && len(cp.completed) > 0
+}
+
+// skip reports whether stage was completed by an earlier attempt and its output is still valid
+func (cp *checkpoint) skip(stage string, valid func() bool) bool {
+	if cp == nil || !cp.completed[stage] {
+		return false
+	}
+	if !valid() {
+		slog.Info("Checkpointed stage output is gone, redoing it", slog.Int("video_id", cp.videoID), slog.String("stage", stage))
+		return false
+	}
+	slog.Info("Skipping stage completed by an earlier attempt", slog.Int("video_id", cp.videoID), slog.String("stage", stage))
+	return true
+}
+
+// done records stage as completed; a failed write is only logged
+func (cp *checkpoint) done(ctx context.Context, stage string) {
+	if cp == nil {
+		return
+	}
+	dbCtx, cancel := cp.vc.dbContext(ctx)
+	defer cancel()
+	if err := MarkStageCompleted(dbCtx, cp.vc.db, cp.videoID, cp.contentHash, stage); err != nil {
+		slog.Warn("Failed to checkpoint stage", slog.Int("video_id", cp.videoID), slog.String("stage", stage), slog.String("error", err.Error()))
+		return
+	}
+	cp.completed[stage] = true
+}
+
+// probeMerged probes the merged file and saves its metadata. When the probe stage was completed and the
+// merged file still has the probed size, the saved metadata is used instead.
+func (vc *VideoConverter) probeMerged(ctx context.Context, cp *checkpoint, videoID int, mergedFile string) (*VideoMetadata, error) {
+	var saved *VideoMetadata
+	unchanged := func() bool {
+		dbCtx, cancel := vc.dbContext(ctx)
+		defer cancel()
+		meta, err := LoadMetadata(dbCtx, vc.db, videoID)
+		info, statErr := os.Stat(mergedFile)
+		saved = meta
+		return err == nil && statErr == nil && info.Size() == meta.Size
+	}
+	if cp.skip(StageProbe, unchanged) {
+		return saved, nil
+	}
+
+	metadata, err := Probe(ctx, mergedFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	if vc.db != nil {
+		dbCtx, cancel := vc.dbContext(ctx)
+		defer cancel()
+		if err := SaveMetadata(dbCtx, vc.db, videoID, metadata); err != nil {
+			slog.Warn("Failed to save video metadata", slog.Int("video_id", videoID), slog.String("error", err.Error()))
+			return metadata, nil
+		}
+	}
+	cp.done(ctx, StageProbe)
+	return metadata, nil
+}
+
+// clear drops the checkpoints once the video is marked processed
+func (cp *checkpoint) clear(ctx context.Context) {
+	if cp == nil {
+		return
+	}
+	dbCtx, cancel := cp.vc.dbContext(ctx)
+	defer cancel()
+	if err := ClearStages(dbCtx, cp.vc.db, cp.videoID); err != nil {
+		slog.Warn("Failed to clear stage checkpoints", slog.Int("video_id", cp.videoID), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Stats is a snapshot of the conversion tables
+type Stats struct {
+	VideosByStatus   map[string]int `json:"videos_by_status"`
+	RecentErrors     int            `json:"recent_errors"`
+	RecentErrorsFrom time.Time      `json:"recent_errors_from"`
+	LastErrorAt      *time.Time     `json:"last_error_at"`
+}
+
+// GetStats counts processed videos by status and the errors logged since now minus window
+func GetStats(db *sql.DB, window time.Duration) (*Stats, error) {
+	stats := &Stats{
+		VideosByStatus:   map[string]int{},
+		RecentErrorsFrom: time.Now().Add(-window),
+	}
+
+	rows, err := db.Query("SELECT status, COUNT(*) FROM processed_videos GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		stats.VideosByStatus[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var lastErrorAt sql.NullTime
+	query := "SELECT COUNT(*) FILTER (WHERE created_at >= $1), MAX(created_at) FROM process_errors_log"
+	if err := db.QueryRow(query, stats.RecentErrorsFrom).Scan(&stats.RecentErrors, &lastErrorAt); err != nil {
+		return nil, err
+	}
+	if lastErrorAt.Valid {
+		stats.LastErrorAt = &lastErrorAt.Time
+	}
+	return stats, nil
+}
@@ -1,109 +1,835 @@
 package converter
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"imersaofc/internal/rabbitmq"
+	"io"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/streadway/amqp"
 )
 
+// Publisher sends messages to the broker; *rabbitmq.RabbitClient satisfies it
+type Publisher interface {
+	PublishMessage(exchange, routingKey, queueName string, message []byte) error
+	PublishMessageWithProperties(exchange, routingKey, queueName string, message []byte, correlationID string, headers amqp.Table) error
+}
+
 type VideoConverter struct {
-	db             *sql.DB
-	rabbitmqClient *rabbitmq.RabbitClient
+	db        *sql.DB
+	publisher Publisher
+	encoder   Encoder
+	cfg       Config
+	// confirmations publishes confirmation messages: cfg.ConfirmationPublisher or RabbitMQ via publisher
+	confirmations ConfirmationPublisher
+
+	// inFlight guarda os video_id (com o path e o cancelamento) que estao sendo processados neste processo
+	inFlight sync.Map
+	// confirmationLimiter smooths confirmation publishes; nil when unlimited
+	confirmationLimiter *rateLimiter
+	// breaker pauses consumption when conversions keep failing; nil when disabled
+	breaker *circuitBreaker
+	// dedup caches recently processed videos in front of IsProcessed; nil when disabled
+	dedup *dedupCache
+	// slots caps concurrent conversions at cfg.Workers; nil when unlimited
+	slots workerSlots
 }
 
-func NewVideoConverter(rabbitmqClient *rabbitmq.RabbitClient, db *sql.DB) *VideoConverter {
+func NewVideoConverter(publisher Publisher, db *sql.DB, encoder Encoder, cfg Config) *VideoConverter {
+	confirmations := cfg.ConfirmationPublisher
+	if confirmations == nil {
+		confirmations = rabbitConfirmations{publisher: publisher}
+	}
 	return &VideoConverter{
-		rabbitmqClient: rabbitmqClient,
-		db:             db,
+		publisher:     publisher,
+		db:            db,
+		encoder:       encoder,
+		cfg:           cfg,
+		confirmations: confirmations,
+
+		confirmationLimiter: newRateLimiter(cfg.ConfirmationRate, cfg.ConfirmationBurst),
+		breaker:             newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		dedup:               newDedupCache(cfg.DedupCacheSize, cfg.DedupCacheTTL),
+		slots:               newWorkerSlots(cfg.Workers),
 	}
 }
 
 // baseado no json enviado {"video_id": 1, "path": "media/uploads/1"}
 type VideoTask struct {
+	Version int    `json:"version,omitempty"`
 	VideoId int    `json:"video_id"`
 	Path    string `json:"path"`
+	Profile string `json:"profile,omitempty"`
+	// ChunkPattern overrides the configured glob for chunk files, e.g. "*.part"
+	ChunkPattern string `json:"chunk_pattern,omitempty"`
+	// AudioTracks maps extra audio files in Path to their language code, e.g. {"dub.m4a": "pt"}
+	AudioTracks map[string]string `json:"audio_tracks,omitempty"`
+	Encryption  *EncryptionKey    `json:"encryption,omitempty"`
+	// OutputFormat is dash (default) or cmaf, which adds an HLS playlist sharing the DASH segments
+	OutputFormat string `json:"output_format,omitempty"`
+	// Remerge rebuilds merged.mp4 even when a valid one from a previous attempt exists
+	Remerge bool `json:"remerge,omitempty"`
+	// Chunks lists the chunk file names in merge order, replacing the chunk pattern and numeric sorting;
+	// a manifest.json with {"chunks": [...]} in Path does the same
+	Chunks []string `json:"chunks,omitempty"`
+	// ChunkChecksums maps chunk file names to their expected SHA-256 (hex); listed chunks are verified before merging
+	ChunkChecksums map[string]string `json:"chunk_checksums,omitempty"`
+	// Force reprocesses the video even if it was already converted, replacing the existing output
+	Force bool `json:"force,omitempty"`
+	// MergeStrategy is bytes (default) or concat, for chunks that are complete media files (see Config.MergeStrategy)
+	MergeStrategy string `json:"merge_strategy,omitempty"`
+	// InputDirs are subdirectories of Path holding the chunks, e.g. one per resumable upload; their chunks
+	// are merged in a single sequence order across all dirs
+	InputDirs []string `json:"input_dirs,omitempty"`
+	// ExtraArgs are appended to the DASH encode as flag/value pairs; every flag must be in Config.AllowedExtraArgs
+	ExtraArgs []string `json:"extra_args,omitempty"`
+	// Start and Duration (seconds) convert only that clip of the source; zero Duration means until the end
+	Start    float64 `json:"start,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	// MediaType is video (default) or image_sequence, whose frames in Path (FramePattern, e.g. "frame_%04d.png")
+	// are encoded at Framerate into the video that is then converted, instead of merging chunks
+	MediaType    string  `json:"media_type,omitempty"`
+	FramePattern string  `json:"frame_pattern,omitempty"`
+	Framerate    float64 `json:"framerate,omitempty"`
+	// BurnSubtitles draws the sidecar .srt/.vtt into the video instead of adding a subtitle track,
+	// also when Features.BurnSubtitles is off
+	BurnSubtitles bool `json:"burn_subtitles,omitempty"`
+
+	// SourceURL holds the original path when it was a remote URL (see prepareRemoteTask)
+	SourceURL string `json:"-"`
+}
+
+// ConversionResult describes what processVideo produced for a task
+type ConversionResult struct {
+	OutputPath string
+	// ManifestPath is the DASH manifest inside OutputPath
+	ManifestPath string
+	// Size is the total bytes written to OutputPath
+	Size int64
+	// Duration of the source in seconds, as probed
+	Duration float64
+	// Renditions lists the encoded video qualities; empty when ffmpeg's defaults were used
+	Renditions []string
+	Subtitles  bool
+	Encryption *EncryptionInfo
+	DashLayout string
+	Preview    string
+	// Thumbnails is the WebVTT thumbnail track inside OutputPath, when generated
+	Thumbnails string
+	// Download is the progressive output.mp4 inside OutputPath, when generated
+	Download string
+	// Checksums is the checksum file inside OutputPath and ManifestChecksum the digest of output.mpd,
+	// both computed with ChecksumAlgorithm, when checksums are enabled
+	Checksums         string
+	ManifestChecksum  string
+	ChecksumAlgorithm string
+	// Manifests maps each protocol (dash, hls) to its manifest path
+	Manifests map[string]string
+	// RenditionDirs maps each video rendition to its directory in the per_rendition layout
+	RenditionDirs map[string]string
+	// BurnedSubtitles is set when the subtitles were drawn into the video instead of muxed as a track
+	BurnedSubtitles bool
+}
+
+// ConfirmationMessage is published once a video has been converted
+type ConfirmationMessage struct {
+	VideoId      int               `json:"video_id"`
+	Path         string            `json:"path"`
+	OutputPath   string            `json:"output_path"`
+	ManifestPath string            `json:"manifest_path"`
+	Size         int64             `json:"size_bytes"`
+	Duration     float64           `json:"duration"`
+	Renditions   []string          `json:"renditions,omitempty"`
+	SourceURL    string            `json:"source_url,omitempty"`
+	Subtitles    bool              `json:"subtitles"`
+	Encryption   *EncryptionInfo   `json:"encryption,omitempty"`
+	DashLayout   string            `json:"dash_layout"`
+	Preview      string            `json:"preview,omitempty"`
+	Thumbnails   string            `json:"thumbnails,omitempty"`
+	Download     string            `json:"download,omitempty"`
+	Manifests    map[string]string `json:"manifests"`
+
+	// ManifestChecksum is "<algorithm>:<hex digest>" of output.mpd; Checksums lists every output file
+	ManifestChecksum string `json:"manifest_checksum,omitempty"`
+	Checksums        string `json:"checksums,omitempty"`
+
+	// RenditionDirs maps each video rendition to its directory when ManifestPath is a per_rendition master
+	RenditionDirs map[string]string `json:"rendition_dirs,omitempty"`
+
+	// BurnedSubtitles tells that the subtitles are part of the picture, with no subtitle track
+	BurnedSubtitles bool `json:"burned_subtitles,omitempty"`
 }
 
 // * = ponteiro, qualquer valor que for alterado utilizando vc. vai ser refletido no codigo
-func (vc *VideoConverter) Handle(d amqp.Delivery, conversionExch, confirmationKey, confirmationQueue string) {
+// Handle processes one delivery. Every delivery is settled: acked, dead-lettered or requeued on failure.
+// Cancelling ctx (e.g. when the broker cancels the consumer) aborts the conversion without acking, so the
+// message is redelivered.
+func (vc *VideoConverter) Handle(ctx context.Context, d amqp.Delivery, conversionExch, confirmationKey, confirmationQueue string) {
+	tracker := &settleTracker{Acknowledger: d.Acknowledger}
+	d.Acknowledger = tracker
+	defer func() {
+		if r := recover(); r != nil {
+			vc.recoverPanic(d, tracker.settled, r)
+		}
+	}()
+
+	// Blocking here keeps this worker from taking more deliveries while the breaker is open;
+	// a canceled session leaves the delivery unacked so the broker redelivers it
+	if err := vc.breaker.Wait(ctx); err != nil {
+		return
+	}
+	outcome := outcomeNeutral
+	defer func() { vc.breaker.Record(outcome) }()
+	if err := vc.slots.Acquire(ctx); err != nil {
+		return
+	}
+	defer vc.slots.Release()
+
+	// notificacoes do S3/MinIO viram tarefas; varios registros seguem como lote
 	var task VideoTask
+	fromEvent := isS3Event(d.Body)
+	if fromEvent {
+		tasks, err := parseS3Event(d.Body)
+		if err != nil {
+			vc.deadLetter(d, task, "Invalid S3 event", err)
+			return
+		}
+		switch len(tasks) {
+		case 0:
+			slog.Info("Ignoring S3 event without uploads")
+			vc.ack(d)
+			return
+		case 1:
+			task = tasks[0]
+		default:
+			d.Body, _ = json.Marshal(BatchTask{Tasks: tasks})
+			fromEvent = false
+		}
+	}
+
+	if isBatch(d.Body) {
+		vc.handleBatch(ctx, d, conversionExch, confirmationKey, confirmationQueue)
+		return
+	}
 
 	//& = quando o comando executar o task alterar na memoria o valor
-	err := json.Unmarshal(d.Body, &task)
+	if !fromEvent {
+		if err := json.Unmarshal(d.Body, &task); err != nil {
+			vc.deadLetter(d, task, "Failed to unmarshal task", err)
+			return
+		}
+	}
+
+	if err := task.Validate(); err != nil {
+		vc.deadLetter(d, task, "Invalid task", err)
+		return
+	}
 
+	// Em modo estrito a confirmacao e gravada junto com o processed_videos e a mensagem so e confirmada depois
+	var pending *PendingConfirmation
+	var outbox func(*ConversionResult) *PendingConfirmation
+	if vc.cfg.StrictAck {
+		outbox = func(result *ConversionResult) *PendingConfirmation {
+			pending = vc.confirmation(task, result, d.CorrelationId, confirmationHeaders(d), conversionExch, confirmationKey, confirmationQueue)
+			return pending
+		}
+	}
+
+	result, err := vc.convertTask(ctx, &task, outbox)
+	outcome = breakerOutcomeOf(result, err)
 	if err != nil {
-		vc.logError(task, "Failed to unmarshal task", err)
+		if errors.Is(err, ErrCanceled) {
+			// cancelado de proposito: nem reentrega nem DLQ
+			vc.ack(d)
+		} else if errors.Is(err, ErrVideoClaimed) {
+			// o dono do claim pode ter caido; tenta de novo depois em vez de perder a mensagem
+			select {
+			case <-ctx.Done():
+			case <-time.After(vc.cfg.ClaimRetryDelay):
+				vc.requeue(d, task)
+			}
+		} else if shouldDeadLetter(err) {
+			vc.reject(d, task)
+			vc.recordEvent(ctx, task.VideoId, EventDeadLettered, err.Error())
+			vc.quarantine(task, err)
+			vc.publishFailure(task, "Conversion failed permanently", err)
+		} else if ctx.Err() == nil {
+			// demais falhas voltam para a fila; MaxAttempts manda o video para a DLQ depois de N tentativas
+			vc.requeue(d, task)
+		}
 		return
 	}
+	if vc.cfg.StrictAck {
+		if pending != nil {
+			vc.deliverStoredConfirmation(ctx, *pending)
+		}
+		vc.ack(d)
+		return
+	}
+	vc.ack(d)
 
-	if IsProcessed(vc.db, task.VideoId) {
-		slog.Warn("Video already processed", slog.Int("video_id", task.VideoId))
-		d.Ack(false)
+	// nil result means the video was skipped as a duplicate
+	if result == nil {
 		return
 	}
+	if err := vc.publishConfirmation(ctx, task, result, d.CorrelationId, confirmationHeaders(d), conversionExch, confirmationKey, confirmationQueue); err != nil {
+		slog.Error("Confirmation not delivered", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+	}
+}
+
+// convertTask converts a validated task and marks it as processed. It returns a nil result when
+// the video is already processed, ErrVideoClaimed when it's in flight in this process or another worker
+// holds its claim, and logs any error it returns. A non-nil outbox builds
+// the confirmation stored in the same transaction as the processed mark.
+func (vc *VideoConverter) convertTask(ctx context.Context, task *VideoTask, outbox func(*ConversionResult) *PendingConfirmation) (result *ConversionResult, err error) {
+	if isRemotePath(task.Path) {
+		if err := vc.prepareRemoteTask(task); err != nil {
+			vc.logError(*task, "Failed to prepare remote source", err)
+			return nil, err
+		}
+	}
 
-	err = vc.processVideo(&task)
+	// Normalized once here so the lock, the hash and the output all agree on the same directory
+	path, err := normalizeMediaPath(task.Path, vc.cfg.MediaRoot)
 	if err != nil {
-		vc.logError(task, "Failed to process video", err)
-		return
+		vc.logError(*task, "Invalid media path", err)
+		return nil, err
+	}
+	task.Path = path
+
+	// Another goroutine in this process is already converting the same video; it owns the work. The
+	// message may carry a re-upload (checked by hash only later), so it's requeued instead of dropped.
+	ctx, cancelConversion := context.WithCancelCause(ctx)
+	defer cancelConversion(nil)
+	if _, loaded := vc.inFlight.LoadOrStore(task.VideoId, &runningConversion{path: task.Path, cancel: cancelConversion}); loaded {
+		slog.Warn("Video is already being processed by this worker", slog.Int("video_id", task.VideoId))
+		return nil, ErrVideoClaimed
+	}
+	defer vc.inFlight.Delete(task.VideoId)
+
+	// cancelada por mensagem de controle: qualquer erro a partir daqui vira ErrCanceled
+	conversionCtx := ctx
+	defer func() {
+		if err != nil && errors.Is(context.Cause(conversionCtx), ErrCanceled) {
+			result, err = nil, vc.canceled(*task, err)
+		}
+	}()
+
+	// Keep the conversion within the broker's consumer_timeout so the delivery isn't canceled mid-encode
+	if vc.cfg.ConversionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vc.cfg.ConversionTimeout)
+		defer cancel()
+	}
+
+	// O hash e o merge precisam ver o upload completo
+	if vc.cfg.ChunkSettleTime > 0 && task.SourceURL == "" {
+		if err := vc.waitForChunks(ctx, *task); err != nil {
+			vc.logError(*task, "Failed waiting for chunks to settle", err)
+			return nil, err
+		}
 	}
 
-	// Mark as processed
-	err = MarkProcessed(vc.db, task.VideoId)
+	// Idempotency keys on (video_id, content hash) so a re-upload under the same id is converted again
+	contentHash, err := vc.contentHash(*task)
 	if err != nil {
-		vc.logError(task, "Failed to mark video as processed", err)
-		return
+		vc.logError(*task, "Failed to hash chunks", err)
+		return nil, err
+	}
+
+	dbCtx, cancelDB := vc.dbContext(ctx)
+	defer cancelDB()
+
+	if task.Force {
+		slog.Info("Forced reprocessing, skipping idempotency checks", slog.Int("video_id", task.VideoId))
+		vc.dedup.forget(task.VideoId)
+	} else if vc.dedup.processed(task.VideoId, contentHash) {
+		// duplicata recente: evita a consulta ao banco
+		vc.handleDuplicate(*task)
+		return nil, nil
+	} else {
+		var processed bool
+		err := vc.retryDB(dbCtx, "is_processed", func() (err error) {
+			processed, err = IsProcessed(dbCtx, vc.db, task.VideoId, contentHash)
+			return err
+		})
+		if err != nil {
+			vc.logError(*task, "Failed to check if video is processed", err)
+			return nil, err
+		}
+		if processed {
+			vc.dedup.add(task.VideoId, contentHash)
+			vc.handleDuplicate(*task)
+			return nil, nil
+		}
+	}
+
+	// Videos that keep failing go to the DLQ instead of being retried on every redelivery
+	status, err := GetStatus(dbCtx, vc.db, task.VideoId)
+	if err != nil {
+		vc.logError(*task, "Failed to get video status", err)
+		return nil, err
+	}
+	if !task.Force && status.Status == StatusCanceled {
+		slog.Warn("Dropping redelivery of canceled video", slog.Int("video_id", task.VideoId))
+		return nil, nil
+	}
+	if !task.Force && status.Status == StatusFailedPermanent {
+		slog.Warn("Dropping redelivery of permanently failed video", slog.Int("video_id", task.VideoId),
+			slog.String("last_error", status.LastError))
+		return nil, nil
+	}
+	if !task.Force && status.Status == StatusFailed && vc.cfg.MaxAttempts > 0 && status.Attempts >= vc.cfg.MaxAttempts {
+		err := fmt.Errorf("%w: video failed %d times", ErrMaxAttempts, status.Attempts)
+		vc.logError(*task, "Giving up on video", err)
+		MarkFailedPermanent(dbCtx, vc.db, task.VideoId, err.Error())
+		return nil, err
+	}
+
+	// The claim covers other workers; a crashed worker's claim expires after ClaimTTL
+	if vc.cfg.ClaimTTL > 0 {
+		claimed, err := ClaimVideo(dbCtx, vc.db, task.VideoId, vc.cfg.ClaimTTL)
+		if err != nil {
+			vc.logError(*task, "Failed to claim video", err)
+			return nil, err
+		}
+		if !claimed {
+			slog.Warn("Video is already being processed by another worker", slog.Int("video_id", task.VideoId))
+			return nil, ErrVideoClaimed
+		}
+		vc.recordEvent(ctx, task.VideoId, EventClaimed, "")
+	}
+
+	// etapas concluidas por uma tentativa anterior com o mesmo conteudo sao puladas
+	cp := vc.loadCheckpoint(ctx, *task, contentHash)
+	result, err = vc.processVideo(ctx, task, cp)
+	if err != nil && errors.Is(context.Cause(ctx), ErrCanceled) {
+		return nil, err
+	}
+	if err != nil {
+		vc.logError(*task, "Failed to process video", err)
+		vc.recordEvent(ctx, task.VideoId, EventFailed, err.Error())
+		failedCtx, cancel := vc.dbContext(ctx)
+		defer cancel()
+		MarkFailed(failedCtx, vc.db, task.VideoId, contentHash)
+
+		// a ultima tentativa permitida: estado terminal com o erro final, e a mensagem vai para a DLQ
+		if vc.cfg.MaxAttempts > 0 && status.Attempts+1 >= vc.cfg.MaxAttempts {
+			MarkFailedPermanent(failedCtx, vc.db, task.VideoId, err.Error())
+			if !shouldDeadLetter(err) {
+				err = fmt.Errorf("%w: video failed %d times: %w", ErrMaxAttempts, status.Attempts+1, err)
+			}
+		}
+		return nil, err
+	}
+
+	// Mark as processed; a fresh timeout, since the conversion may have used up the first one
+	doneCtx, cancelDone := vc.dbContext(ctx)
+	defer cancelDone()
+	err = vc.retryDB(doneCtx, "mark_processed", func() error {
+		if outbox != nil {
+			return markProcessedWithConfirmation(doneCtx, vc.db, task.VideoId, contentHash, result, *outbox(result))
+		}
+		return MarkProcessed(doneCtx, vc.db, task.VideoId, contentHash, result)
+	})
+	if err != nil {
+		vc.logError(*task, "Failed to mark video as processed", err)
+		return nil, err
 	}
-	d.Ack(false)
 	slog.Info("Video marked as processed", slog.Int("video_id", task.VideoId))
+	vc.dedup.add(task.VideoId, contentHash)
+	cp.clear(ctx)
+	vc.recordEvent(ctx, task.VideoId, EventSucceeded, result.ManifestPath)
+	return result, nil
+}
 
-	confirmationMessage := []byte(fmt.Sprintf(`{"video_id": %d, "path":"%s"}`, task.VideoId, task.Path))
-	err = vc.rabbitmqClient.PublishMessage(conversionExch, confirmationKey, confirmationQueue, confirmationMessage)
+// publishConfirmation notifies downstream services that the video was converted. Failed publishes are
+// retried and then stored for the confirmation sweeper, so the confirmation isn't lost.
+func (vc *VideoConverter) publishConfirmation(ctx context.Context, task VideoTask, result *ConversionResult, correlationID string, headers map[string]string,
+	conversionExch, confirmationKey, confirmationQueue string) error {
+	return vc.publishWithRetry(ctx, *vc.confirmation(task, result, correlationID, headers, conversionExch, confirmationKey, confirmationQueue))
+}
+
+// confirmation builds the confirmation message of a converted video
+func (vc *VideoConverter) confirmation(task VideoTask, result *ConversionResult, correlationID string, headers map[string]string,
+	conversionExch, confirmationKey, confirmationQueue string) *PendingConfirmation {
+	confirmationMessage, _ := json.Marshal(ConfirmationMessage{
+		VideoId:          task.VideoId,
+		Path:             task.Path,
+		OutputPath:       result.OutputPath,
+		ManifestPath:     result.ManifestPath,
+		Size:             result.Size,
+		Duration:         result.Duration,
+		Renditions:       result.Renditions,
+		SourceURL:        redactURL(task.SourceURL),
+		Subtitles:        result.Subtitles,
+		Encryption:       result.Encryption,
+		DashLayout:       result.DashLayout,
+		Preview:          result.Preview,
+		Thumbnails:       result.Thumbnails,
+		Download:         result.Download,
+		Checksums:        result.Checksums,
+		ManifestChecksum: manifestChecksum(result),
+		Manifests:        result.Manifests,
+		RenditionDirs:    result.RenditionDirs,
+		BurnedSubtitles:  result.BurnedSubtitles,
+	})
+	return &PendingConfirmation{
+		VideoId:       task.VideoId,
+		Exchange:      conversionExch,
+		RoutingKey:    confirmationKey,
+		Queue:         confirmationQueue,
+		Payload:       confirmationMessage,
+		CorrelationId: correlationID,
+		Headers:       headers,
+	}
 }
 
-func (vc *VideoConverter) processVideo(task *VideoTask) error {
-	mergedFile := filepath.Join(task.Path, "merged.mp4")
-	mpegDashPath := filepath.Join(task.Path, "mpeg-dash")
+// processVideo runs the conversion pipeline. Stages cp records as completed are skipped when their output is
+// still valid; a nil cp runs every stage.
+func (vc *VideoConverter) processVideo(ctx context.Context, task *VideoTask, cp *checkpoint) (_ *ConversionResult, err error) {
+	result := &ConversionResult{}
+
+	// Resolve the profile first so an unknown name fails before any work is done
+	profile, err := vc.resolveProfile(task.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExtraArgs(task.ExtraArgs, vc.cfg.AllowedExtraArgs); err != nil {
+		return nil, err
+	}
+
+	// Intermediate files go to the work dir; only the final DASH output is copied to the media path
+	workDir, err := vc.prepareWorkDir(task)
+	if err != nil {
+		return nil, err
+	}
+	if workDir != task.Path {
+		defer func() {
+			// Falha que vai ser retentada mantem o work dir: a proxima entrega retoma do checkpoint
+			if err != nil && !shouldDeadLetter(err) {
+				slog.Info("Keeping work dir for retry", slog.Int("video_id", task.VideoId), slog.String("work_dir", workDir))
+				return
+			}
+			vc.removeWorkDir(workDir)
+		}()
+	}
+
+	outputPath, workSubdir, err := vc.outputDir(task)
+	if err != nil {
+		return nil, err
+	}
+	result.OutputPath = outputPath
+
+	// Saida valida de uma entrega anterior pode estar sendo servida: reaproveita em vez de sobrescrever.
+	// Uma tentativa interrompida depois do encode segue para as etapas que faltam.
+	if cp != nil && !task.Force && !cp.resuming() {
+		if existing, ok := vc.existingOutput(ctx, task, outputPath, cp.contentHash); ok {
+			slog.Info("Reusing existing DASH output", slog.Int("video_id", task.VideoId), slog.String("path", outputPath))
+			return existing, nil
+		}
+	}
+
+	mergedFile := filepath.Join(workDir, "merged.mp4")
+	mpegDashPath := filepath.Join(workDir, workSubdir)
+	if workDir == task.Path {
+		mpegDashPath = outputPath
+	}
+
+	if cp.skip(StageMerge, func() bool { return exists(mergedFile) }) {
+		// merged.mp4 da tentativa anterior; o probe confirma que ainda e legivel
+	} else if task.SourceURL != "" {
+		// Fonte remota ja montada: baixa para o work dir no lugar do merge
+		if err := vc.downloadSource(ctx, task.SourceURL, mergedFile); err != nil {
+			return nil, err
+		}
+	} else if vc.canReuseMerge(ctx, *task, mergedFile) {
+		slog.Info("Reusing existing merged file", slog.Int("video_id", task.VideoId), slog.String("file", mergedFile))
+	} else if task.MediaType == MediaTypeImageSequence {
+		slog.Info("Encoding image sequence", slog.String("path", task.Path), slog.String("pattern", framePattern(*task)))
+		vc.recordEvent(ctx, task.VideoId, EventMerging, MediaTypeImageSequence)
+		if err := vc.encodeImageSequence(ctx, *task, mergedFile); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMergeFailed, diskError(err))
+		}
+	} else {
+		if vc.cfg.ValidateChunks || len(task.ChunkChecksums) > 0 {
+			if err := vc.validateChunks(*task); err != nil {
+				return nil, err
+			}
+		}
+
+		// Merge chunks
+		slog.Info("Merging chunks", slog.String("path", task.Path))
+		vc.recordEvent(ctx, task.VideoId, EventMerging, "")
+		if err := vc.mergeChunks(ctx, *task, mergedFile); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMergeFailed, diskError(err))
+		}
+	}
+
+	cp.done(ctx, StageMerge)
 
-	// Merge chunks
-	slog.Info("Merging chunks", slog.String("path", task.Path))
-	if err := vc.mergeChunks(task.Path, mergedFile); err != nil {
-		return fmt.Errorf("failed to merge chunks: %v", err)
+	metadata, err := vc.probeMerged(ctx, cp, task.VideoId, mergedFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := vc.checkInputLimits(metadata); err != nil {
+		return nil, err
+	}
+	if err := checkClipRange(*task, metadata); err != nil {
+		return nil, err
+	}
+
+	// Forced runs replace the previous output instead of mixing old and new segments
+	if task.Force {
+		for _, dir := range []string{mpegDashPath, result.OutputPath} {
+			if err := os.RemoveAll(dir); err != nil {
+				return nil, fmt.Errorf("failed to remove existing output: %v", err)
+			}
+		}
 	}
 
 	// Create directory for MPEG-DASH output
 	if err := os.MkdirAll(mpegDashPath, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	var opts EncodeOptions
+	opts.HardwareAccel = vc.cfg.Features.HardwareAccel
+	opts.HardwareAccelType, opts.HardwareDevice = vc.cfg.HardwareAccelType, vc.cfg.HardwareDevice
+	opts.Start, opts.Duration = task.Start, task.Duration
+	opts.ExtraArgs = task.ExtraArgs
+	if vc.cfg.FFmpegLogToFile {
+		opts.LogFile = filepath.Join(task.Path, "ffmpeg.log")
+	}
+	result.DashLayout = vc.dashLayout()
+	opts.SingleFile = result.DashLayout == DashLayoutSingleFile
+	opts.PerRendition = result.DashLayout == DashLayoutPerRendition
+	if profile != nil {
+		opts.Renditions = profile.Renditions
+		opts.AudioBitrate = profile.AudioBitrate
+	} else if vc.cfg.AutoLadder {
+		opts.Renditions = autoLadder(metadata.Width, metadata.Height)
+		slog.Info("Using auto-generated bitrate ladder", slog.Int("video_id", task.VideoId),
+			slog.Int("source_height", metadata.Height), slog.Int("renditions", len(opts.Renditions)))
+	}
+	if vc.cfg.TwoPass || (profile != nil && profile.TwoPass) {
+		// prefixo por video: workers concorrentes nao podem compartilhar o passlog
+		opts.PassLogFile = filepath.Join(workDir, fmt.Sprintf("ffmpeg2pass-%d", task.VideoId))
 	}
 
-	// Convert to MPEG-DASH
-	ffmpegCmd := exec.Command(
-		"ffmpeg", "-i", mergedFile, // Arquivo de entrada
-		"-f", "dash", // Formato de saída
-		filepath.Join(mpegDashPath, "output.mpd"), // Caminho para salvar o arquivo .mpd
-	)
-	output, err := ffmpegCmd.CombinedOutput()
+	audioTracks, err := vc.findAudioTracks(*task)
 	if err != nil {
-		return fmt.Errorf("failed to convert to MPEG-DASH: %v, output: %s", err, string(output))
+		return nil, err
+	}
+	if len(audioTracks) > 0 {
+		opts.AudioTracks = audioTracks
+		slog.Info("Including audio tracks", slog.Int("video_id", task.VideoId), slog.Int("tracks", len(audioTracks)))
+	}
+
+	// sem nenhuma trilha de audio nao ha o que normalizar
+	if vc.cfg.Features.Loudnorm && (metadata.AudioCodec != "" || len(audioTracks) > 0) {
+		loudnorm := vc.cfg.Loudnorm
+		opts.Loudnorm = &loudnorm
 	}
-	slog.Info("Converted to MPEG-DASH", slog.String("path", mpegDashPath))
+
+	// Legendas opcionais: desenhadas no video ou como trilha (.vtt), nunca os dois
+	if vc.burnSubtitles(*task) {
+		subtitle, err := findBurnInSubtitle(task.Path)
+		if err != nil {
+			return nil, err
+		}
+		if subtitle != "" {
+			opts.BurnSubtitles = subtitle
+			opts.SubtitleStyle = vc.cfg.SubtitleStyle
+			result.BurnedSubtitles = true
+			slog.Info("Burning in subtitles", slog.Int("video_id", task.VideoId), slog.String("subtitle", filepath.Base(subtitle)))
+		}
+	} else if vc.cfg.Features.Subtitles {
+		subtitles, err := vc.findSubtitles(task.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(subtitles) > 0 {
+			opts.Subtitles = subtitles
+			result.Subtitles = true
+			slog.Info("Including subtitles", slog.Int("video_id", task.VideoId), slog.Int("tracks", len(subtitles)))
+		}
+	}
+
+	if vc.cfg.EnableEncryption {
+		key, err := vc.resolveEncryptionKey(ctx, task)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve encryption key: %v", err)
+		}
+		opts.Encryption = key
+		opts.EncryptionScheme = vc.cfg.EncryptionScheme
+		result.Encryption = &EncryptionInfo{Scheme: vc.cfg.EncryptionScheme, KeyID: key.KeyID}
+	}
+
+	result.ManifestPath = filepath.Join(result.OutputPath, "output.mpd")
+	result.Manifests = map[string]string{"dash": result.ManifestPath}
+	if vc.outputFormat(*task) == OutputFormatCMAF {
+		opts.HLSPlaylist = true
+		result.Manifests["hls"] = filepath.Join(result.OutputPath, "master.m3u8")
+	}
+
+	// a chave pode mudar entre tentativas (key server), entao saida criptografada e sempre refeita
+	encoded := func() bool {
+		return !vc.cfg.EnableEncryption && checkManifest(filepath.Join(mpegDashPath, "output.mpd")) == nil
+	}
+	if !cp.skip(StageEncode, encoded) {
+		// Convert to MPEG-DASH
+		vc.recordEvent(ctx, task.VideoId, EventConverting, vc.outputFormat(*task))
+		if err := vc.encoder.Encode(ctx, mergedFile, mpegDashPath, opts); err != nil {
+			return nil, err
+		}
+		slog.Info("Converted to MPEG-DASH", slog.String("path", mpegDashPath))
+
+		// Sem manifesto valido a conversao falha e nao e marcada como processada
+		if err := checkManifest(filepath.Join(mpegDashPath, "output.mpd")); err != nil {
+			return nil, err
+		}
+		if err := checkSegments(filepath.Join(mpegDashPath, "output.mpd")); err != nil {
+			return nil, err
+		}
+		// segmentos cifrados nao decodificam sem a chave, e o demuxer dash nao repassa -decryption_key
+		if vc.cfg.VerifySegments > 0 && opts.Encryption != nil {
+			slog.Info("Skipping playback verification of encrypted output", slog.Int("video_id", task.VideoId))
+		} else if vc.cfg.VerifySegments > 0 {
+			if err := verifyPlayback(ctx, filepath.Join(mpegDashPath, "output.mpd"), vc.cfg.VerifySegments); err != nil {
+				return nil, err
+			}
+		}
+		cp.done(ctx, StageEncode)
+	}
+
+	if err := vc.runPostProcessors(ctx, *task, mpegDashPath); err != nil {
+		return nil, err
+	}
+
+	progressive, err := vc.createProgressiveMP4(ctx, task, mergedFile, mpegDashPath)
+	if err != nil {
+		return nil, err
+	}
+	if progressive {
+		result.Download = filepath.Join(result.OutputPath, "output.mp4")
+	}
+
+	thumbnails := func() bool { return exists(filepath.Join(mpegDashPath, "thumbnails.vtt")) }
+	if cp.skip(StageThumbnails, thumbnails) || vc.createThumbnails(ctx, task, mergedFile, mpegDashPath, metadata) {
+		result.Thumbnails = filepath.Join(result.OutputPath, "thumbnails.vtt")
+		cp.done(ctx, StageThumbnails)
+	}
+
+	// por ultimo: o arquivo de checksums precisa cobrir todo o resto da saida
+	if vc.cfg.Features.Checksums {
+		name, digest, err := writeChecksums(mpegDashPath, vc.checksumAlgorithm())
+		if err != nil {
+			return nil, fmt.Errorf("failed to write output checksums: %w", err)
+		}
+		result.Checksums = filepath.Join(result.OutputPath, name)
+		result.ManifestChecksum = digest
+		result.ChecksumAlgorithm = vc.checksumAlgorithm()
+	}
+
+	result.Duration = clipDuration(*task, metadata)
+	for _, rendition := range opts.Renditions {
+		result.Renditions = append(result.Renditions, rendition.Name)
+	}
+	if opts.PerRendition {
+		result.RenditionDirs = renditionDirs(result.OutputPath, opts.Renditions)
+	}
+	if result.Size, err = dirSize(mpegDashPath); err != nil {
+		slog.Warn("Failed to measure output size", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+	}
+
+	result.Preview = vc.createPreview(ctx, task, mergedFile, metadata)
+
+	if workDir != task.Path {
+		if err := copyDir(mpegDashPath, result.OutputPath); err != nil {
+			return nil, fmt.Errorf("failed to copy output to media path: %v", err)
+		}
+		slog.Info("Copied DASH output to media path", slog.String("path", result.OutputPath))
+		return result, nil
+	}
+
 	// Remove merged file after processing
-	if err := os.Remove(mergedFile); err != nil {
-		slog.Warn("Failed to remove merged file", slog.String("file", mergedFile), slog.String("error", err.Error()))
+	if vc.cfg.Features.Cleanup {
+		vc.removeMergedFile(task, mergedFile)
 	}
-	slog.Info("Removed merged file", slog.String("file", mergedFile))
-	return nil
+	return result, nil
+}
+
+// handleDuplicate logs a redelivery of an already processed video and removes what the previous run left behind
+func (vc *VideoConverter) handleDuplicate(task VideoTask) {
+	// processed_at e status ajudam a separar uma reentrega legitima de um registro travado
+	ctx, cancel := vc.dbContext(context.Background())
+	defer cancel()
+	status, err := GetStatus(ctx, vc.db, task.VideoId)
+	if err != nil {
+		slog.Warn("Video already processed", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+	} else {
+		slog.Warn("Video already processed", slog.Int("video_id", task.VideoId),
+			slog.Time("processed_at", status.ProcessedAt), slog.String("status", status.Status), slog.Int("attempts", status.Attempts))
+	}
+
+	if vc.cfg.Features.Cleanup {
+		vc.cleanupIntermediates(task)
+	}
+}
+
+// cleanupIntermediates removes the uploaded chunks (globbed and explicitly listed) and any stale merged file from the task path
+func (vc *VideoConverter) cleanupIntermediates(task VideoTask) {
+	files, err := filepath.Glob(filepath.Join(task.Path, vc.chunkPattern(task)))
+	if err != nil {
+		slog.Warn("Failed to list chunks for cleanup", slog.String("path", task.Path), slog.String("error", err.Error()))
+		return
+	}
+	if names, ok, _ := listedChunks(task); ok {
+		for _, name := range names {
+			files = append(files, filepath.Join(task.Path, name))
+		}
+	}
+	for _, dir := range task.InputDirs {
+		dirFiles, _ := filepath.Glob(filepath.Join(task.Path, dir, vc.chunkPattern(task)))
+		files = append(files, dirFiles...)
+	}
+	if task.MediaType == MediaTypeImageSequence {
+		frames, _, _ := findFrames(task)
+		files = append(files, frames...)
+	}
+	files = append(files, filepath.Join(task.Path, "merged.mp4"))
+
+	for _, file := range files {
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove intermediate file", slog.String("file", file), slog.String("error", err.Error()))
+			continue
+		}
+		if err == nil {
+			slog.Info("Removed intermediate file", slog.String("file", file))
+		}
+	}
+}
+
+// findSubtitles returns the sidecar .vtt files uploaded alongside the chunks
+func (vc *VideoConverter) findSubtitles(inputDir string) ([]string, error) {
+	subtitles, err := filepath.Glob(filepath.Join(inputDir, "*.vtt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subtitles: %v", err)
+	}
+	sort.Strings(subtitles)
+	return subtitles, nil
 }
 
 func (vc *VideoConverter) logError(task VideoTask, message string, err error) {
@@ -111,14 +837,73 @@ func (vc *VideoConverter) logError(task VideoTask, message string, err error) {
 		"video_id": task.VideoId,
 		"error":    message,
 		"details":  err.Error(),
+		"kind":     ErrorKind(err),
 		"time":     time.Now(),
 	}
 
+	// Para falhas do ffmpeg guarda o comando e a saida completa (limitada) para diagnostico
+	var ffmpegErr *FFmpegError
+	if errors.As(err, &ffmpegErr) {
+		errorData["ffmpeg_command"] = ffmpegErr.CommandLine()
+		errorData["ffmpeg_output"] = truncateOutput(ffmpegErr.Output, vc.cfg.MaxErrorOutputBytes)
+		if ffmpegErr.LogFile != "" {
+			errorData["ffmpeg_log_file"] = ffmpegErr.LogFile
+		}
+	}
+
 	serializedError, _ := json.Marshal(errorData)
 	slog.Error("Processing error", slog.String("error_details", string(serializedError)))
 
-	//todo register error on database
-	RegisterError(vc.db, errorData, err)
+	ctx, cancel := vc.dbContext(context.Background())
+	defer cancel()
+	RegisterError(ctx, vc.db, errorData, err)
+}
+
+// deadLetter records the failure and rejects the message without requeueing, so the broker routes it to the dead-letter exchange
+func (vc *VideoConverter) deadLetter(d amqp.Delivery, task VideoTask, message string, err error) {
+	vc.logError(task, message, err)
+	vc.reject(d, task)
+	vc.publishFailure(task, message, err)
+}
+
+// ack confirms the message unless the consumer runs in auto-ack mode
+func (vc *VideoConverter) ack(d amqp.Delivery) {
+	if vc.cfg.AutoAck {
+		return
+	}
+	if err := d.Ack(false); err != nil {
+		slog.Error("Failed to ack message", slog.String("error", err.Error()))
+	}
+}
+
+// requeue nacks the message back onto the queue for another attempt
+func (vc *VideoConverter) requeue(d amqp.Delivery, task VideoTask) {
+	if vc.cfg.AutoAck {
+		return
+	}
+	if err := d.Nack(false, true); err != nil {
+		slog.Error("Failed to requeue message", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+	}
+}
+
+// reject nacks the message without requeueing it
+func (vc *VideoConverter) reject(d amqp.Delivery, task VideoTask) {
+	// em auto-ack a mensagem ja foi removida da fila pelo broker
+	if vc.cfg.AutoAck {
+		slog.Warn("Auto-ack enabled, failed message is dropped instead of dead-lettered", slog.Int("video_id", task.VideoId))
+		return
+	}
+	if err := d.Nack(false, false); err != nil {
+		slog.Error("Failed to dead-letter message", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+	}
+}
+
+// truncateOutput keeps the last limit bytes of the output, where ffmpeg reports the actual failure
+func truncateOutput(output string, limit int) string {
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	return "...(truncated)\n" + output[len(output)-limit:]
 }
 
 func (vc *VideoConverter) extractNumber(fileName string) int {
@@ -132,11 +917,88 @@ func (vc *VideoConverter) extractNumber(fileName string) int {
 	return num
 }
 
-func (vc *VideoConverter) mergeChunks(inputDir, outputFile string) error {
-	// Buscar todos os arquivos .chunk no diretório
-	chunks, err := filepath.Glob(filepath.Join(inputDir, "*.chunk"))
+// chunkPattern returns the glob used to find chunk files for the task
+func (vc *VideoConverter) chunkPattern(task VideoTask) string {
+	if task.ChunkPattern != "" {
+		return task.ChunkPattern
+	}
+	if vc.cfg.ChunkPattern != "" {
+		return vc.cfg.ChunkPattern
+	}
+	return DefaultChunkPattern
+}
+
+// manifestChecksum formats the manifest digest as <algorithm>:<hex>, or "" without checksums
+func manifestChecksum(result *ConversionResult) string {
+	if result.ManifestChecksum == "" {
+		return ""
+	}
+	return result.ChecksumAlgorithm + ":" + result.ManifestChecksum
+}
+
+// checksumAlgorithm returns the configured checksum algorithm or the default
+func (vc *VideoConverter) checksumAlgorithm() string {
+	if vc.cfg.ChecksumAlgorithm != "" {
+		return vc.cfg.ChecksumAlgorithm
+	}
+	return DefaultChecksumAlgorithm
+}
+
+// outputFormat returns the task's output format, falling back to the configured default
+func (vc *VideoConverter) outputFormat(task VideoTask) string {
+	if task.OutputFormat != "" {
+		return task.OutputFormat
+	}
+	if vc.cfg.OutputFormat != "" {
+		return vc.cfg.OutputFormat
+	}
+	return OutputFormatDASH
+}
+
+// canReuseMerge reports whether mergedFile was left complete by a previous attempt (e.g. one whose encode
+// failed): its size must match the chunks and ffprobe must read it. Force and Remerge always merge again.
+func (vc *VideoConverter) canReuseMerge(ctx context.Context, task VideoTask, mergedFile string) bool {
+	// o tamanho do video codificado nao tem relacao com o dos frames
+	if task.Force || task.Remerge || task.MediaType == MediaTypeImageSequence {
+		return false
+	}
+	info, err := os.Stat(mergedFile)
+	if err != nil {
+		return false
+	}
+
+	chunks, err := vc.taskChunks(task)
 	if err != nil {
-		return fmt.Errorf("failed to find chunks: %v", err)
+		return false
+	}
+	var expected int64
+	for _, chunk := range chunks {
+		chunkInfo, err := os.Stat(chunk)
+		if err != nil {
+			return false
+		}
+		expected += chunkInfo.Size()
+	}
+	if info.Size() != expected {
+		return false
+	}
+
+	if _, err := Probe(ctx, mergedFile); err != nil {
+		slog.Warn("Existing merged file is not readable, merging again", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		return false
+	}
+	return true
+}
+
+// findChunks returns the chunk files in inputDir matching pattern, in merge order
+func (vc *VideoConverter) findChunks(inputDir, pattern string) ([]string, error) {
+	// Buscar todos os arquivos de chunk no diretório
+	chunks, err := filepath.Glob(filepath.Join(inputDir, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chunks: %v", err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: pattern %s in %s", ErrNoChunks, pattern, inputDir)
 	}
 
 	//Slice = array que pode aumentar de capacidade
@@ -145,6 +1007,17 @@ func (vc *VideoConverter) mergeChunks(inputDir, outputFile string) error {
 		//numero atual que esta e vai comparar se o i for menor que o extracNumber retorna true e nao muda a posicao, caso contrario muda
 		return vc.extractNumber(chunks[i]) < vc.extractNumber(chunks[j])
 	})
+	return chunks, nil
+}
+
+func (vc *VideoConverter) mergeChunks(ctx context.Context, task VideoTask, outputFile string) error {
+	chunks, err := vc.taskChunks(task)
+	if err != nil {
+		return err
+	}
+	if vc.mergeStrategy(task) == MergeStrategyConcat {
+		return vc.concatChunks(ctx, chunks, outputFile)
+	}
 
 	//criando arquivo de saida
 	output, err := os.Create(outputFile)
@@ -156,6 +1029,7 @@ func (vc *VideoConverter) mergeChunks(inputDir, outputFile string) error {
 	defer output.Close()
 
 	// _ = indice (blank identify)
+	var merged int64
 	for _, chunk := range chunks {
 		// abrindo arquivo chunk
 		input, err := os.Open(chunk)
@@ -163,12 +1037,25 @@ func (vc *VideoConverter) mergeChunks(inputDir, outputFile string) error {
 			return fmt.Errorf("failed to open chunk %s: %v", chunk, err)
 		}
 
-		// _ = nao quero usar como resultado, quero que apenas faca a copia
-		_, err = output.ReadFrom(input)
-		if err != nil {
-			return fmt.Errorf("failed to write chunk %s to merged file: %v", chunk, err)
+		// com limite, le no maximo um byte alem do permitido para detectar o excesso sem copiar o resto
+		var reader io.Reader = input
+		if vc.cfg.MaxMergedBytes > 0 {
+			reader = io.LimitReader(input, vc.cfg.MaxMergedBytes-merged+1)
 		}
+		n, err := output.ReadFrom(reader)
 		input.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write chunk %s to merged file: %w", chunk, err)
+		}
+		merged += n
+
+		if vc.cfg.MaxMergedBytes > 0 && merged > vc.cfg.MaxMergedBytes {
+			output.Close()
+			if err := os.Remove(outputFile); err != nil {
+				slog.Warn("Failed to remove partial merged file", slog.String("file", outputFile), slog.String("error", err.Error()))
+			}
+			return fmt.Errorf("%w: merged chunks exceed the limit of %d bytes", ErrInputRejected, vc.cfg.MaxMergedBytes)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+// fakeAcknowledger records how a delivery was settled
+type fakeAcknowledger struct {
+	acks, requeues, rejects int
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acks++
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		a.requeues++
+	} else {
+		a.rejects++
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func fakeDelivery(body string) (amqp.Delivery, *fakeAcknowledger) {
+	ack := &fakeAcknowledger{}
+	return amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte(body)}, ack
+}
+
+func TestSettleDelivery(t *testing.T) {
+	tests := []struct {
+		name    string
+		autoAck bool
+		settle  func(vc *VideoConverter, d amqp.Delivery)
+		want    fakeAcknowledger
+	}{
+		{"ack", false, func(vc *VideoConverter, d amqp.Delivery) { vc.ack(d) }, fakeAcknowledger{acks: 1}},
+		{"requeue", false, func(vc *VideoConverter, d amqp.Delivery) { vc.requeue(d, VideoTask{}) }, fakeAcknowledger{requeues: 1}},
+		{"reject", false, func(vc *VideoConverter, d amqp.Delivery) { vc.reject(d, VideoTask{}) }, fakeAcknowledger{rejects: 1}},
+		// em auto-ack o broker ja removeu a mensagem: nada e confirmado de novo
+		{"ack with auto-ack", true, func(vc *VideoConverter, d amqp.Delivery) { vc.ack(d) }, fakeAcknowledger{}},
+		{"requeue with auto-ack", true, func(vc *VideoConverter, d amqp.Delivery) { vc.requeue(d, VideoTask{}) }, fakeAcknowledger{}},
+		{"reject with auto-ack", true, func(vc *VideoConverter, d amqp.Delivery) { vc.reject(d, VideoTask{}) }, fakeAcknowledger{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vc := &VideoConverter{cfg: Config{AutoAck: tt.autoAck}}
+			d, ack := fakeDelivery("{}")
+			tt.settle(vc, d)
+			if *ack != tt.want {
+				t.Errorf("got %+v, want %+v", *ack, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleAcksIgnoredMessage(t *testing.T) {
+	// an S3 event without uploads is handled without touching the database
+	body := `{"Records": [{"eventName": "s3:ObjectRemoved:Delete", "s3": {"bucket": {"name": "media"}, "object": {"key": "uploads/1/a.mp4"}}}]}`
+
+	for _, autoAck := range []bool{false, true} {
+		vc := &VideoConverter{cfg: Config{AutoAck: autoAck}}
+		d, ack := fakeDelivery(body)
+		vc.Handle(context.Background(), d, "exchange", "key", "queue")
+
+		want := 1
+		if autoAck {
+			want = 0
+		}
+		if ack.acks != want || ack.requeues != 0 || ack.rejects != 0 {
+			t.Errorf("auto-ack %v: got %+v, want %d ack", autoAck, *ack, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThumbnailConfig controls the scrubber thumbnails: one frame every Interval seconds, Width pixels wide,
+// tiled Columns x Rows per sprite image
+type ThumbnailConfig struct {
+	Interval float64
+	Width    int
+	Columns  int
+	Rows     int
+}
+
+// generateThumbnails writes sprite-NNN.jpg images and thumbnails.vtt (time ranges mapped to sprite
+// coordinates with #xywh) into outputDir, returning the path of the VTT file
+func generateThumbnails(ctx context.Context, input, outputDir string, clip []string, metadata *VideoMetadata, cfg ThumbnailConfig) (string, error) {
+	if metadata.Width <= 0 || metadata.Height <= 0 || metadata.Duration <= 0 {
+		return "", fmt.Errorf("source has no video dimensions or duration")
+	}
+
+	// altura par mantendo a proporcao, igual ao scale=W:-2 usado no ffmpeg
+	height := int(math.Round(float64(cfg.Width)*float64(metadata.Height)/float64(metadata.Width)/2)) * 2
+	filter := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		strconv.FormatFloat(cfg.Interval, 'f', -1, 64), cfg.Width, height, cfg.Columns, cfg.Rows)
+	args := append([]string{"-y"}, clip...)
+	args = append(args,
+		"-i", input,
+		"-an",
+		"-vf", filter,
+		filepath.Join(outputDir, "sprite-%03d.jpg"),
+	)
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", &FFmpegError{Args: args, Output: string(out), Err: err}
+	}
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n\n")
+	perSprite := cfg.Columns * cfg.Rows
+	frames := int(math.Ceil(metadata.Duration / cfg.Interval))
+	for i := 0; i < frames; i++ {
+		start := float64(i) * cfg.Interval
+		end := math.Min(start+cfg.Interval, metadata.Duration)
+		position := i % perSprite
+		x := (position % cfg.Columns) * cfg.Width
+		y := (position / cfg.Columns) * height
+		// o ffmpeg numera os sprites a partir de 1
+		fmt.Fprintf(&vtt, "%s --> %s\nsprite-%03d.jpg#xywh=%d,%d,%d,%d\n\n",
+			vttTimestamp(start), vttTimestamp(end), i/perSprite+1, x, y, cfg.Width, height)
+	}
+
+	output := filepath.Join(outputDir, "thumbnails.vtt")
+	if err := os.WriteFile(output, []byte(vtt.String()), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write thumbnails.vtt: %v", err)
+	}
+	return output, nil
+}
+
+// vttTimestamp formats seconds as HH:MM:SS.mmm
+func vttTimestamp(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+// createThumbnails generates the thumbnail track for the task when enabled. Like previews, a failure
+// doesn't fail the conversion.
+func (vc *VideoConverter) createThumbnails(ctx context.Context, task *VideoTask, input, outputDir string, metadata *VideoMetadata) bool {
+	if !vc.cfg.Features.Thumbnails {
+		return false
+	}
+
+	// clips get thumbnails for their own timeline, starting at 0
+	clipped := *metadata
+	clipped.Duration = clipDuration(*task, metadata)
+	clip := clipArgs(EncodeOptions{Start: task.Start, Duration: task.Duration})
+	vtt, err := generateThumbnails(ctx, input, outputDir, clip, &clipped, vc.cfg.Thumbnails)
+	if err != nil {
+		slog.Warn("Failed to generate thumbnails", slog.Int("video_id", task.VideoId), slog.String("error", err.Error()))
+		return false
+	}
+	slog.Info("Generated thumbnails", slog.Int("video_id", task.VideoId), slog.String("file", vtt))
+	return true
+}
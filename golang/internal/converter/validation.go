@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CurrentTaskVersion is the newest message schema this worker understands.
+// Messages without a version are treated as version 1.
+const CurrentTaskVersion = 1
+
+// Validate checks that a decoded task can be processed
+func (t *VideoTask) Validate() error {
+	if t.Version < 0 || t.Version > CurrentTaskVersion {
+		return fmt.Errorf("unsupported task version %d (supported up to %d)", t.Version, CurrentTaskVersion)
+	}
+	if t.VideoId <= 0 {
+		return fmt.Errorf("video_id must be greater than zero, got %d", t.VideoId)
+	}
+	if t.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	if !validOutputFormat(t.OutputFormat) {
+		return fmt.Errorf("invalid output_format %q, expected %s or %s", t.OutputFormat, OutputFormatDASH, OutputFormatCMAF)
+	}
+
+	if !validMergeStrategy(t.MergeStrategy) {
+		return fmt.Errorf("invalid merge_strategy %q, expected %s or %s", t.MergeStrategy, MergeStrategyBytes, MergeStrategyConcat)
+	}
+
+	if !validMediaType(t.MediaType) {
+		return fmt.Errorf("invalid media_type %q, expected %s or %s", t.MediaType, MediaTypeVideo, MediaTypeImageSequence)
+	}
+	if t.FramePattern != "" && !validFramePattern(t.FramePattern) {
+		return fmt.Errorf("invalid frame_pattern %q: must be a file name with a single %%d or %%0Nd", t.FramePattern)
+	}
+	if t.Framerate < 0 {
+		return fmt.Errorf("framerate must not be negative, got %g", t.Framerate)
+	}
+
+	if t.ChunkPattern != "" {
+		if _, err := filepath.Match(t.ChunkPattern, ""); err != nil {
+			return fmt.Errorf("invalid chunk_pattern %q: %v", t.ChunkPattern, err)
+		}
+		if strings.ContainsAny(t.ChunkPattern, `/\`) {
+			return fmt.Errorf("chunk_pattern %q must not contain path separators", t.ChunkPattern)
+		}
+	}
+
+	for _, dir := range t.InputDirs {
+		clean := filepath.Clean(dir)
+		if dir == "" || filepath.IsAbs(dir) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid input dir %q: must be a directory inside path", dir)
+		}
+	}
+
+	if t.Start < 0 || t.Duration < 0 {
+		return fmt.Errorf("start and duration must not be negative, got %g and %g", t.Start, t.Duration)
+	}
+
+	for _, name := range t.Chunks {
+		if name == "" || name == ".." || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid chunk name %q: must be a file name inside path", name)
+		}
+	}
+
+	if isRemotePath(t.Path) {
+		parsed, err := url.Parse(t.Path)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("path %s is not a valid URL", t.Path)
+		}
+		return nil
+	}
+
+	// Relative paths are resolved against MEDIA_ROOT and checked by normalizeMediaPath
+	if !filepath.IsAbs(t.Path) {
+		return nil
+	}
+
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return fmt.Errorf("path %s is not accessible: %v", t.Path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("path %s is not a directory", t.Path)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dashSegmentSeconds is the segment duration of ffmpeg's dash muxer, which the encode leaves at its default
+const dashSegmentSeconds = 5
+
+// verifyPlayback decodes the first segments referenced by the manifest, the way a player would, and fails
+// when ffmpeg reports any decode error. segments controls the depth; full playback is expensive.
+func verifyPlayback(ctx context.Context, manifest string, segments int) error {
+	seconds := segments * dashSegmentSeconds
+	args := []string{
+		"-hide_banner", "-v", "error", "-xerror",
+		"-i", manifest,
+		"-t", strconv.Itoa(seconds),
+		"-f", "null", "-",
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	// o dash demuxer resolve os segmentos relativos ao diretorio do manifesto
+	cmd.Dir = filepath.Dir(manifest)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return &FFmpegError{Args: args, Output: string(output), Err: fmt.Errorf("playback verification failed: %w", err)}
+	}
+	if decodeErrors := strings.TrimSpace(string(output)); decodeErrors != "" {
+		return &FFmpegError{Args: args, Output: decodeErrors, Err: fmt.Errorf("playback verification reported decode errors")}
+	}
+
+	slog.Info("Verified playback", slog.String("manifest", manifest), slog.Int("segments", segments))
+	return nil
+}
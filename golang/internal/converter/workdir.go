@@ -0,0 +1,96 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// prepareWorkDir returns the directory where intermediate files for the task are written.
+// Without a configured WorkDir the task path itself is used. The dir is the same for every delivery
+// of a video, so a retry finds what the failed attempt left behind.
+func (vc *VideoConverter) prepareWorkDir(task *VideoTask) (string, error) {
+	if vc.cfg.WorkDir == "" {
+		return task.Path, nil
+	}
+
+	workDir := filepath.Join(vc.cfg.WorkDir, "video-"+strconv.Itoa(task.VideoId))
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create task work dir: %v", err)
+	}
+	slog.Info("Using work dir", slog.Int("video_id", task.VideoId), slog.String("work_dir", workDir))
+	return workDir, nil
+}
+
+// removeWorkDir deletes a task work dir and everything left inside it
+func (vc *VideoConverter) removeWorkDir(workDir string) {
+	if err := os.RemoveAll(workDir); err != nil {
+		slog.Warn("Failed to remove work dir", slog.String("work_dir", workDir), slog.String("error", err.Error()))
+		return
+	}
+	slog.Info("Removed work dir", slog.String("work_dir", workDir))
+}
+
+// copyDir recursively copies the contents of src into dst, creating dst if needed
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		return copyFile(path, target)
+	})
+}
+
+// copyFile copies a single file, overwriting the destination
+func copyFile(src, dst string) error {
+	input, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+// dirSize returns the total size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,218 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"imersaofc/internal/converter"
+)
+
+// TaskPublisher enqueues conversion tasks; *rabbitmq.RabbitClient satisfies it
+type TaskPublisher interface {
+	PublishTask(exchange, routingKey, queueName string, message []byte, priority uint8) error
+}
+
+// Config secures the gRPC port
+type Config struct {
+	// TLSCertFile and TLSKeyFile serve TLS; both empty means plaintext
+	TLSCertFile string
+	TLSKeyFile  string
+	// AuthToken is required as "authorization: Bearer <token>" metadata on every call; empty disables auth
+	AuthToken string
+}
+
+// Server implements the videoconverter.v1.VideoConverter service described in converter.proto
+type Server struct {
+	vc        *converter.VideoConverter
+	db        *sql.DB
+	publisher TaskPublisher
+	exchange  string
+	key       string
+	queue     string
+	cfg       Config
+}
+
+// NewServer creates the gRPC service. Queued submissions are published to exchange/key/queue, the
+// same destination the worker consumes from.
+func NewServer(vc *converter.VideoConverter, db *sql.DB, publisher TaskPublisher, exchange, key, queue string, cfg Config) *Server {
+	return &Server{vc: vc, db: db, publisher: publisher, exchange: exchange, key: key, queue: queue, cfg: cfg}
+}
+
+// ListenAndServe serves the service on addr until the listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(s.authenticate)}
+	if s.cfg.TLSCertFile != "" || s.cfg.TLSKeyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if s.cfg.AuthToken == "" {
+		slog.Warn("gRPC server has no auth token, any client can submit conversions")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&serviceDesc, s)
+	slog.Info("gRPC server listening", slog.String("addr", addr), slog.Bool("tls", len(opts) > 1))
+	return srv.Serve(listener)
+}
+
+// authenticate rejects calls without the configured bearer token
+func (s *Server) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.cfg.AuthToken == "" {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AuthToken)) == 1 {
+			return handler(ctx, req)
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing or invalid auth token")
+}
+
+// submitRequest is a task plus how it should be submitted
+type submitRequest struct {
+	converter.VideoTask
+	// Wait converts synchronously instead of queueing the task
+	Wait     bool  `json:"wait"`
+	Priority uint8 `json:"priority"`
+}
+
+// submitResponse reports a queued task or the outcome of a synchronous conversion
+type submitResponse struct {
+	VideoId      int               `json:"video_id"`
+	Status       string            `json:"status"` // queued, converted ou skipped (ja processado)
+	OutputPath   string            `json:"output_path,omitempty"`
+	ManifestPath string            `json:"manifest_path,omitempty"`
+	Size         int64             `json:"size_bytes,omitempty"`
+	Duration     float64           `json:"duration,omitempty"`
+	Renditions   []string          `json:"renditions,omitempty"`
+	Manifests    map[string]string `json:"manifests,omitempty"`
+}
+
+// SubmitConversion queues the task, or runs it with the worker's idempotency and status tracking when wait is set
+func (s *Server) SubmitConversion(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	var req submitRequest
+	if err := fromStruct(in, &req); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid task: %v", err)
+	}
+	task := req.VideoTask
+	if err := task.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid task: %v", err)
+	}
+
+	if !req.Wait {
+		body, err := json.Marshal(task)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode task: %v", err)
+		}
+		if err := s.publisher.PublishTask(s.exchange, s.key, s.queue, body, req.Priority); err != nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to queue task: %v", err)
+		}
+		slog.Info("Queued conversion via gRPC", slog.Int("video_id", task.VideoId))
+		return toStruct(submitResponse{VideoId: task.VideoId, Status: "queued"})
+	}
+
+	result, err := s.vc.RunTask(ctx, &task)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		if errors.Is(err, converter.ErrVideoClaimed) {
+			return nil, status.Errorf(codes.Aborted, "%v", err)
+		}
+		if errors.Is(err, converter.ErrInputRejected) || errors.Is(err, converter.ErrMaxAttempts) {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "conversion failed: %v", err)
+	}
+	if result == nil {
+		return toStruct(submitResponse{VideoId: task.VideoId, Status: "skipped"})
+	}
+	return toStruct(submitResponse{
+		VideoId:      task.VideoId,
+		Status:       "converted",
+		OutputPath:   result.OutputPath,
+		ManifestPath: result.ManifestPath,
+		Size:         result.Size,
+		Duration:     result.Duration,
+		Renditions:   result.Renditions,
+		Manifests:    result.Manifests,
+	})
+}
+
+// statusResponse is the processed_videos row of a video
+type statusResponse struct {
+	VideoId     int       `json:"video_id"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	ProcessedAt time.Time `json:"processed_at"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// GetStatus reads the recorded status of a video; NotFound when it was never attempted
+func (s *Server) GetStatus(ctx context.Context, in *wrapperspb.Int64Value) (*structpb.Struct, error) {
+	videoID := int(in.GetValue())
+	if videoID <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "video_id must be greater than zero, got %d", videoID)
+	}
+
+	videoStatus, err := converter.GetStatus(ctx, s.db, videoID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get status: %v", err)
+	}
+	if videoStatus.Status == "" {
+		return nil, status.Errorf(codes.NotFound, "video %d was never processed", videoID)
+	}
+	return toStruct(statusResponse{
+		VideoId:     videoID,
+		Status:      videoStatus.Status,
+		Attempts:    videoStatus.Attempts,
+		ProcessedAt: videoStatus.ProcessedAt,
+		LastError:   videoStatus.LastError,
+	})
+}
+
+// fromStruct decodes a Struct through its JSON form, so the task keeps the queue message's field names
+func fromStruct(in *structpb.Struct, v any) error {
+	data, err := protojson.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func toStruct(v any) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	out := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, out); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// converterService is the handler type checked by RegisterService
+type converterService interface {
+	SubmitConversion(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	GetStatus(context.Context, *wrapperspb.Int64Value) (*structpb.Struct, error)
+}
+
+// serviceDesc mirrors converter.proto. It is written by hand since the messages are well-known types
+// and there is no generated code to register.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "videoconverter.v1.VideoConverter",
+	HandlerType: (*converterService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "SubmitConversion", Handler: submitConversionHandler},
+		{MethodName: "GetStatus", Handler: getStatusHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "converter.proto",
+}
+
+func submitConversionHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(converterService).SubmitConversion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/videoconverter.v1.VideoConverter/SubmitConversion"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(converterService).SubmitConversion(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func getStatusHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.Int64Value)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(converterService).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/videoconverter.v1.VideoConverter/GetStatus"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(converterService).GetStatus(ctx, req.(*wrapperspb.Int64Value))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"imersaofc/internal/converter"
+)
+
+// Config holds the producer settings for confirmations sent to Kafka
+type Config struct {
+	// Brokers are the bootstrap addresses, e.g. ["kafka:9092"]
+	Brokers []string
+	// Topic receives every confirmation; the exchange and routing key of the confirmation are ignored
+	Topic string
+	// WriteTimeout bounds each publish, including waiting for the in-sync replicas to acknowledge it
+	WriteTimeout time.Duration
+}
+
+// ConfirmationPublisher publishes confirmations to a Kafka topic, keyed by video_id so every event of a video
+// lands on the same partition in order. It implements converter.ConfirmationPublisher.
+type ConfirmationPublisher struct {
+	writer *kafkago.Writer
+}
+
+// NewConfirmationPublisher creates a synchronous producer that waits for every in-sync replica; it fails
+// without brokers or topic. Close it on shutdown to flush the writer and release its connections.
+func NewConfirmationPublisher(cfg Config) (*ConfirmationPublisher, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, errors.New("kafka brokers and topic are required")
+	}
+	return &ConfirmationPublisher{
+		writer: &kafkago.Writer{
+			Addr:     kafkago.TCP(cfg.Brokers...),
+			Topic:    cfg.Topic,
+			Balancer: &kafkago.Hash{},
+			// a publicacao so conta como entregue quando todas as replicas confirmarem
+			RequiredAcks: kafkago.RequireAll,
+			WriteTimeout: cfg.WriteTimeout,
+			// uma mensagem por chamada: sem esperar o lote encher
+			BatchSize: 1,
+		},
+	}, nil
+}
+
+// PublishConfirmation writes the confirmation JSON with its headers (and correlation_id, which Kafka has no
+// property for) as Kafka record headers
+func (p *ConfirmationPublisher) PublishConfirmation(ctx context.Context, confirmation converter.PendingConfirmation) error {
+	msg := kafkago.Message{
+		Key:   []byte(strconv.Itoa(confirmation.VideoId)),
+		Value: confirmation.Payload,
+	}
+	if confirmation.CorrelationId != "" {
+		msg.Headers = append(msg.Headers, kafkago.Header{Key: "correlation_id", Value: []byte(confirmation.CorrelationId)})
+	}
+	for name, value := range confirmation.Headers {
+		msg.Headers = append(msg.Headers, kafkago.Header{Key: name, Value: []byte(value)})
+	}
+	return p.writer.WriteMessages(ctx, msg)
+}
+
+// Close flushes pending writes and closes the connections to the brokers
+func (p *ConfirmationPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,2 @@
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
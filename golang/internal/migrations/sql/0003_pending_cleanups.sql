@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS pending_cleanups (
+    path TEXT PRIMARY KEY,
+    video_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
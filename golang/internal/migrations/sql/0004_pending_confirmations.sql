@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS pending_confirmations (
+    video_id INT PRIMARY KEY,
+    exchange VARCHAR(255) NOT NULL,
+    routing_key VARCHAR(255) NOT NULL,
+    queue VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
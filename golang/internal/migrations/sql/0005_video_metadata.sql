@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS video_metadata (
+    video_id INT PRIMARY KEY,
+    duration DOUBLE PRECISION NOT NULL,
+    size BIGINT NOT NULL,
+    bit_rate BIGINT NOT NULL,
+    video_codec VARCHAR(50) NOT NULL,
+    audio_codec VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    probed_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE pending_confirmations ADD COLUMN IF NOT EXISTS headers JSONB;
@@ -0,0 +1,3 @@
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS manifest_path TEXT;
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS output_bytes BIGINT;
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS duration DOUBLE PRECISION;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS video_events (
+    id BIGSERIAL PRIMARY KEY,
+    video_id INT NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    detail TEXT,
+    worker_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS video_events_video_id_idx ON video_events (video_id, created_at);
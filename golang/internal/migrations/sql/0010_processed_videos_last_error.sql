@@ -0,0 +1,2 @@
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS last_error TEXT;
+CREATE INDEX IF NOT EXISTS processed_videos_status_idx ON processed_videos (status);
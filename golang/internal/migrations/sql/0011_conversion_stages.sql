@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS conversion_stages (
+    video_id INT NOT NULL,
+    stage VARCHAR(50) NOT NULL,
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    completed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (video_id, stage)
+);
@@ -0,0 +1 @@
+ALTER TABLE processed_videos ADD COLUMN IF NOT EXISTS result JSONB;
@@ -0,0 +1 @@
+ALTER TABLE pending_confirmations ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(255);
@@ -0,0 +1,49 @@
+package rabbitmq
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultBackoffInitial = time.Second
+	defaultBackoffMax     = 30 * time.Second
+)
+
+// dialWithBackoff keeps trying to connect with capped exponential backoff and full jitter until
+// cfg.ConnectRetryWindow elapses. A zero window tries only once.
+func dialWithBackoff(url string, cfg Config) (*amqp.Connection, *amqp.Channel, error) {
+	initial := cfg.BackoffInitial
+	if initial <= 0 {
+		initial = defaultBackoffInitial
+	}
+	maxDelay := cfg.BackoffMax
+	if maxDelay <= 0 {
+		maxDelay = defaultBackoffMax
+	}
+
+	deadline := time.Now().Add(cfg.ConnectRetryWindow)
+	delay := initial
+	for attempt := 1; ; attempt++ {
+		conn, channel, err := newConnection(url, cfg)
+		if err == nil {
+			return conn, channel, nil
+		}
+
+		// jitter entre zero e o atraso atual evita que varios workers reconectem ao mesmo tempo
+		wait := time.Duration(rand.Int64N(int64(delay)) + 1)
+		if time.Now().Add(wait).After(deadline) {
+			return nil, nil, err
+		}
+		slog.Warn("RabbitMQ not reachable, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("wait", wait),
+			slog.String("error", err.Error()))
+		time.Sleep(wait)
+
+		delay = min(delay*2, maxDelay)
+	}
+}
@@ -1,20 +1,96 @@
 package rabbitmq
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
 
+// Config holds the broker-side settings shared by consumers and publishers
+type Config struct {
+	// ExchangeType is the kind used when declaring exchanges (direct, topic, fanout, headers)
+	ExchangeType string
+	// TLS is applied to amqps:// URLs
+	TLS TLSConfig
+	// AutoAck consumes in at-most-once mode: deliveries are acked by the broker when sent, so failed
+	// conversions are never redelivered or dead-lettered
+	AutoAck bool
+	// ConnectRetryWindow is how long connecting (at startup or after a lost connection) keeps retrying
+	// with exponential backoff between BackoffInitial and BackoffMax before giving up
+	ConnectRetryWindow time.Duration
+	BackoffInitial     time.Duration
+	BackoffMax         time.Duration
+	// MaxPriority declares the consume queue with x-max-priority so higher-priority deliveries go first;
+	// 0 disables priorities. RabbitMQ can't add the argument to an existing queue, so it must be recreated.
+	MaxPriority uint8
+	// ContentType is set on published messages; empty means application/json
+	ContentType string
+	// Persistent publishes with delivery mode 2, so messages in durable queues survive a broker restart
+	Persistent bool
+	// PassiveDeclare only checks that exchanges and queues exist instead of declaring them, for brokers
+	// whose topology is managed elsewhere or was declared with different arguments
+	PassiveDeclare bool
+	// Prefetch caps the unacknowledged deliveries sent to the consumer; 0 means unlimited
+	Prefetch int
+	// ResourcePrefix is prepended to every exchange, queue and routing key name, isolating environments
+	// that share a broker
+	ResourcePrefix string
+	// ConsumerTag identifies this instance's consumer in the management UI and in CancelConsumer;
+	// empty uses DefaultConsumerTag
+	ConsumerTag string
+	// PublisherConfirms puts the channel in confirm mode: publishes return only once the broker has taken
+	// responsibility for the message, failing when it nacks or doesn't answer within ConfirmTimeout
+	PublisherConfirms bool
+	ConfirmTimeout    time.Duration
+}
+
+const defaultConfirmTimeout = 10 * time.Second
+
+// DefaultConsumerTag is unique per process: goapp-<hostname>-<pid>
+func DefaultConsumerTag() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("goapp-%s-%d", host, os.Getpid())
+}
+
 type RabbitClient struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	url     string
+	mu                 sync.RWMutex // protege conn e channel durante a reconexao
+	conn               *amqp.Connection
+	channel            *amqp.Channel
+	url                string
+	cfg                Config
+	deadLetterExchange string
+	deadLetterQueue    string
+
+	// publicacoes confirmadas sao serializadas para casar cada confirmacao com sua mensagem
+	publishMu sync.Mutex
+	confirms  chan amqp.Confirmation
+	// nextTag is the delivery tag of the next publish on the current channel
+	nextTag uint64
 }
 
-// newConnection establishes a new connection and channel with RabbitMQ
-func newConnection(url string) (*amqp.Connection, *amqp.Channel, error) {
-	conn, err := amqp.Dial(url)
+// newConnection establishes a new connection and channel with RabbitMQ, using TLS for amqps:// URLs
+func newConnection(url string, cfg Config) (*amqp.Connection, *amqp.Channel, error) {
+	var conn *amqp.Connection
+	var err error
+
+	if strings.HasPrefix(url, "amqps://") {
+		tlsConfig, tlsErr := cfg.TLS.build()
+		if tlsErr != nil {
+			return nil, nil, tlsErr
+		}
+		conn, err = amqp.DialTLS(url, tlsConfig)
+	} else {
+		conn, err = amqp.Dial(url)
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
@@ -25,44 +101,220 @@ func newConnection(url string) (*amqp.Connection, *amqp.Channel, error) {
 		return nil, nil, fmt.Errorf("failed to open channel: %v", err)
 	}
 
+	if cfg.PublisherConfirms {
+		if err := channel.Confirm(false); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+		}
+	}
+
 	return conn, channel, nil
 }
 
 // NewRabbitClient creates a new RabbitMQ client with the given connection URL
-func NewRabbitClient(connectionURL string) (*RabbitClient, error) {
-	conn, channel, err := newConnection(connectionURL)
+func NewRabbitClient(connectionURL string, cfg Config) (*RabbitClient, error) {
+	if cfg.ExchangeType == "" {
+		cfg.ExchangeType = "direct"
+	}
+
+	conn, channel, err := dialWithBackoff(connectionURL, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &RabbitClient{
+	client := &RabbitClient{
 		conn:    conn,
 		channel: channel,
 		url:     connectionURL,
-	}, nil
+		cfg:     cfg,
+	}
+	client.watchConfirms(channel)
+	return client, nil
 }
 
-// ConsumeMessages consumes messages from a specified exchange using a custom queue name and routing key
-func (client *RabbitClient) ConsumeMessages(exchange, routingKey, queueName string) (<-chan amqp.Delivery, error) {
-	err := client.channel.ExchangeDeclare(
-		exchange, "direct", true, true, false, false, nil)
+// watchConfirms subscribes to the publisher confirms of a new channel, whose delivery tags start at 1
+func (client *RabbitClient) watchConfirms(channel *amqp.Channel) {
+	if !client.cfg.PublisherConfirms {
+		return
+	}
+	client.publishMu.Lock()
+	defer client.publishMu.Unlock()
+	client.confirms = channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	client.nextTag = 1
+}
+
+// ch returns the current channel, which changes after a Reconnect
+func (client *RabbitClient) ch() *amqp.Channel {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.channel
+}
+
+// Reconnect replaces a lost connection, retrying with backoff, and declares the dead-letter setup again
+func (client *RabbitClient) Reconnect() error {
+	client.mu.Lock()
+	client.channel.Close()
+	client.conn.Close()
+
+	conn, channel, err := dialWithBackoff(client.url, client.cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare exchange: %v", err)
+		client.mu.Unlock()
+		return err
+	}
+	client.conn = conn
+	client.channel = channel
+	client.mu.Unlock()
+	client.watchConfirms(channel)
+
+	slog.Info("Reconnected to RabbitMQ")
+	if client.deadLetterExchange != "" {
+		return client.DeclareDeadLetter(client.deadLetterExchange, client.deadLetterQueue)
+	}
+	return nil
+}
+
+// name applies the resource prefix; empty names (default exchange, server-named queues) are kept as is
+func (client *RabbitClient) name(s string) string {
+	if s == "" {
+		return s
 	}
+	return client.cfg.ResourcePrefix + s
+}
+
+// declareExchange declares the exchange with the configured type, explaining type mismatches with an existing exchange
+func (client *RabbitClient) declareExchange(exchange string) error {
+	if client.cfg.PassiveDeclare {
+		if err := client.ch().ExchangeDeclarePassive(exchange, client.cfg.ExchangeType, true, true, false, false, nil); err != nil {
+			return fmt.Errorf("exchange %q does not exist (RABBITMQ_PASSIVE_DECLARE is set, so it isn't created): %v", exchange, err)
+		}
+		return nil
+	}
+
+	err := client.ch().ExchangeDeclare(
+		exchange, client.cfg.ExchangeType, true, true, false, false, nil)
+	if err == nil {
+		return nil
+	}
+	return exchangeDeclareError(exchange, client.cfg.ExchangeType, err)
+}
 
-	queue, err := client.channel.QueueDeclare(
-		queueName, true, true, false, false, nil)
+// exchangeDeclareError explains a failed exchange declaration; PRECONDITION_FAILED means the exchange
+// already exists with another type
+func exchangeDeclareError(exchange, exchangeType string, err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		slog.Error("Exchange already exists with a different type",
+			slog.String("exchange", exchange),
+			slog.String("expected_type", exchangeType))
+		return fmt.Errorf("exchange %q already exists with a type other than %q; set EXCHANGE_TYPE to match it or delete the exchange: %v",
+			exchange, exchangeType, err)
+	}
+	return fmt.Errorf("failed to declare exchange: %v", err)
+}
+
+// declareQueue declares a durable, auto-delete queue with args, or only checks it exists in passive mode.
+// A queue that exists with other arguments fails with PRECONDITION_FAILED, which is explained in the error.
+func (client *RabbitClient) declareQueue(queueName string, args amqp.Table) (amqp.Queue, error) {
+	if client.cfg.PassiveDeclare {
+		queue, err := client.ch().QueueDeclarePassive(queueName, true, true, false, false, args)
+		if err != nil {
+			return queue, fmt.Errorf("queue %q does not exist (RABBITMQ_PASSIVE_DECLARE is set, so it isn't created): %v", queueName, err)
+		}
+		return queue, nil
+	}
+
+	queue, err := client.ch().QueueDeclare(queueName, true, true, false, false, args)
+	if err == nil {
+		return queue, nil
+	}
+
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		slog.Error("Queue already exists with different arguments",
+			slog.String("queue", queueName),
+			slog.Any("expected_args", args))
+		return queue, fmt.Errorf("queue %q already exists with different arguments (expected %v); delete and recreate it, "+
+			"or set RABBITMQ_PASSIVE_DECLARE to use the existing definition: %v", queueName, args, err)
+	}
+	return queue, fmt.Errorf("failed to declare queue: %v", err)
+}
+
+// DeclareDeadLetter declares a dead-letter exchange and queue; queues declared afterwards by ConsumeMessages
+// route rejected messages to it
+func (client *RabbitClient) DeclareDeadLetter(exchange, queueName string) error {
+	err := client.ch().ExchangeDeclare(
+		client.name(exchange), "fanout", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %v", err)
+	}
+
+	queue, err := client.ch().QueueDeclare(
+		client.name(queueName), true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %v", err)
+	}
+
+	err = client.ch().QueueBind(queue.Name, "", client.name(exchange), false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %v", err)
+	}
+
+	client.deadLetterExchange = exchange
+	client.deadLetterQueue = queueName
+	return nil
+}
+
+// queueArgs returns the arguments used when declaring the consume queue
+func (client *RabbitClient) queueArgs() amqp.Table {
+	args := amqp.Table{}
+	if client.deadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = client.name(client.deadLetterExchange)
+	}
+	if client.cfg.MaxPriority > 0 {
+		args["x-max-priority"] = int32(client.cfg.MaxPriority)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// declareConsumeQueue declares the exchange and the consume queue and binds them, returning the queue name
+func (client *RabbitClient) declareConsumeQueue(exchange, routingKey, queueName string) (string, error) {
+	exchange, routingKey, queueName = client.name(exchange), client.name(routingKey), client.name(queueName)
+
+	err := client.declareExchange(exchange)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare queue: %v", err)
+		return "", err
 	}
 
-	err = client.channel.QueueBind(queue.Name, routingKey, exchange, false, nil)
+	queue, err := client.declareQueue(queueName, client.queueArgs())
 	if err != nil {
-		return nil, fmt.Errorf("failed to bind queue: %v", err)
+		return "", err
+	}
+
+	err = client.ch().QueueBind(queue.Name, routingKey, exchange, false, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to bind queue: %v", err)
+	}
+	return queue.Name, nil
+}
+
+// ConsumeMessages consumes messages from a specified exchange using a custom queue name and routing key
+func (client *RabbitClient) ConsumeMessages(exchange, routingKey, queueName string) (<-chan amqp.Delivery, error) {
+	queue, err := client.declareConsumeQueue(exchange, routingKey, queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.cfg.Prefetch > 0 {
+		if err := client.ch().Qos(client.cfg.Prefetch, 0, false); err != nil {
+			return nil, fmt.Errorf("failed to set prefetch: %v", err)
+		}
 	}
 
 	// consumindo a mensagem
-	msgs, err := client.channel.Consume(queue.Name, "goapp", false, false, false, false, nil)
+	msgs, err := client.ch().Consume(queue, client.ConsumerTag(), client.cfg.AutoAck, false, false, false, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to consume messages: %v", err)
 	}
@@ -70,37 +322,230 @@ func (client *RabbitClient) ConsumeMessages(exchange, routingKey, queueName stri
 	return msgs, nil
 }
 
-func (client *RabbitClient) PublishMessage(exchange, routingKey, queueName string, message [] byte) error{
-	err := client.channel.ExchangeDeclare(
-		exchange, "direct", true, true, false, false, nil)
+// ConsumeControl subscribes to the fanout exchange operators broadcast control messages on. Each worker
+// gets its own exclusive, server-named queue, so every instance sees every message; deliveries are
+// auto-acked since a missed control message only matters while the worker is up.
+func (client *RabbitClient) ConsumeControl(exchange string) (<-chan amqp.Delivery, error) {
+	exchange = client.name(exchange)
+	err := client.ch().ExchangeDeclare(exchange, "fanout", true, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare control exchange: %v", err)
+	}
+
+	queue, err := client.ch().QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare control queue: %v", err)
+	}
+
+	err = client.ch().QueueBind(queue.Name, "", exchange, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind control queue: %v", err)
+	}
+
+	msgs, err := client.ch().Consume(queue.Name, client.ConsumerTag()+"-control", true, true, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume control messages: %v", err)
+	}
+	return msgs, nil
+}
+
+// ConsumerTag is the tag ConsumeMessages registers its consumer with
+func (client *RabbitClient) ConsumerTag() string {
+	if client.cfg.ConsumerTag == "" {
+		return DefaultConsumerTag()
+	}
+	return client.cfg.ConsumerTag
+}
+
+// CancelConsumer stops the broker from sending new deliveries to the consumer with this tag. The
+// deliveries channel is closed once the ones already sent have been received, and unacked messages
+// can still be acked, so in-flight work finishes cleanly.
+func (client *RabbitClient) CancelConsumer(tag string) error {
+	if err := client.ch().Cancel(tag, false); err != nil {
+		return fmt.Errorf("failed to cancel consumer %s: %v", tag, err)
+	}
+	return nil
+}
+
+// GetMessage pulls a single message with basic.get instead of keeping a consumer open; ok is false
+// when the queue is empty
+func (client *RabbitClient) GetMessage(exchange, routingKey, queueName string) (d amqp.Delivery, ok bool, err error) {
+	queue, err := client.declareConsumeQueue(exchange, routingKey, queueName)
+	if err != nil {
+		return amqp.Delivery{}, false, err
+	}
+
+	d, ok, err = client.ch().Get(queue, client.cfg.AutoAck)
+	if err != nil {
+		return amqp.Delivery{}, false, fmt.Errorf("failed to get message: %v", err)
+	}
+	return d, ok, nil
+}
+
+// GetFromQueue pulls a single message from an already declared queue (e.g. the dead-letter queue) with
+// manual ack, whatever AutoAck says; ok is false when the queue is empty
+func (client *RabbitClient) GetFromQueue(queueName string) (d amqp.Delivery, ok bool, err error) {
+	d, ok, err = client.ch().Get(client.name(queueName), false)
+	if err != nil {
+		return amqp.Delivery{}, false, fmt.Errorf("failed to get message: %v", err)
+	}
+	return d, ok, nil
+}
+
+func (client *RabbitClient) PublishMessage(exchange, routingKey, queueName string, message []byte) error {
+	return client.publish(exchange, routingKey, queueName, nil, client.publishing(message, nil))
+}
+
+// publishing builds the message with the configured content type and delivery mode and the given headers
+func (client *RabbitClient) publishing(message []byte, headers amqp.Table) amqp.Publishing {
+	msg := amqp.Publishing{
+		Headers:      headers,
+		ContentType:  client.cfg.ContentType,
+		DeliveryMode: amqp.Transient,
+		Body:         message,
+	}
+	if msg.ContentType == "" {
+		msg.ContentType = "application/json"
+	}
+	if client.cfg.Persistent {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	return msg
+}
+
+// PublishMessageWithProperties publishes like PublishMessage, setting the correlation_id property and the
+// given AMQP headers so consumers can filter without parsing the body
+func (client *RabbitClient) PublishMessageWithProperties(exchange, routingKey, queueName string, message []byte, correlationID string, headers amqp.Table) error {
+	msg := client.publishing(message, headers)
+	msg.CorrelationId = correlationID
+	return client.publish(exchange, routingKey, queueName, nil, msg)
+}
+
+// PublishTask publishes a conversion task with the given priority (capped at MaxPriority by the broker).
+// The queue is declared with the consume queue arguments, so it's meant for the conversion queue, e.g. when
+// reprocessing or retrying videos.
+func (client *RabbitClient) PublishTask(exchange, routingKey, queueName string, message []byte, priority uint8) error {
+	msg := client.publishing(message, nil)
+	msg.Priority = priority
+	return client.publish(exchange, routingKey, queueName, client.queueArgs(), msg)
+}
+
+func (client *RabbitClient) publish(exchange, routingKey, queueName string, args amqp.Table, msg amqp.Publishing) error {
+	exchange, routingKey, queueName = client.name(exchange), client.name(routingKey), client.name(queueName)
+
+	err := client.declareExchange(exchange)
 	if err != nil {
-		return fmt.Errorf("failed to declare exchange: %v", err)
+		return err
 	}
 
-	queue, err := client.channel.QueueDeclare(
-		queueName, true, true, false, false, nil)
+	queue, err := client.declareQueue(queueName, args)
 	if err != nil {
-		return fmt.Errorf("failed to declare queue: %v", err)
+		return err
 	}
 
-	err = client.channel.QueueBind(queue.Name, routingKey, exchange, false, nil)
+	err = client.ch().QueueBind(queue.Name, routingKey, exchange, false, nil)
 	if err != nil {
 		return fmt.Errorf("failed to bind queue: %v", err)
 	}
 
-	err = client.channel.Publish(
-		exchange, routingKey, false, false, amqp.Publishing{
-			ContentType: "application/json",
-			Body: message,
-		},
-	)
-	if err != nil{
+	if client.cfg.PublisherConfirms {
+		return client.publishConfirmed(exchange, routingKey, msg)
+	}
+	err = client.ch().Publish(exchange, routingKey, false, false, msg)
+	if err != nil {
 		return fmt.Errorf("failed to publish messages: %v", err)
 	}
 	return nil
 }
 
+// publishConfirmed publishes and waits for the broker's confirmation of that message. Confirmations left
+// over from publishes that timed out are skipped by their delivery tag.
+func (client *RabbitClient) publishConfirmed(exchange, routingKey string, msg amqp.Publishing) error {
+	client.publishMu.Lock()
+	defer client.publishMu.Unlock()
+
+	if err := client.ch().Publish(exchange, routingKey, false, false, msg); err != nil {
+		return fmt.Errorf("failed to publish messages: %v", err)
+	}
+	tag := client.nextTag
+	client.nextTag++
+
+	timeout := client.cfg.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = defaultConfirmTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case confirmation, ok := <-client.confirms:
+			if !ok {
+				return errors.New("channel closed before the broker confirmed the message")
+			}
+			if confirmation.DeliveryTag < tag {
+				continue
+			}
+			if !confirmation.Ack {
+				return fmt.Errorf("broker rejected the message published to %s", exchange)
+			}
+			return nil
+		case <-timer.C:
+			return fmt.Errorf("broker didn't confirm the message within %s", timeout)
+		}
+	}
+}
+
+// QueueDepth returns how many messages are ready in the queue. It uses a short-lived channel, since
+// inspecting a missing queue makes the broker close the channel and would take the consumer down with it.
+func (client *RabbitClient) QueueDepth(queueName string) (int, error) {
+	client.mu.RLock()
+	conn := client.conn
+	client.mu.RUnlock()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open channel: %v", err)
+	}
+	defer channel.Close()
+
+	queue, err := channel.QueueInspect(client.name(queueName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect queue: %v", err)
+	}
+	return queue.Messages, nil
+}
+
+// NotifyConsumerLost returns a channel that is closed when the broker cancels the consumer
+// (e.g. after exceeding consumer_timeout) or closes the channel
+func (client *RabbitClient) NotifyConsumerLost() <-chan struct{} {
+	canceled := client.ch().NotifyCancel(make(chan string, 1))
+	closed := client.ch().NotifyClose(make(chan *amqp.Error, 1))
+	lost := make(chan struct{})
+
+	go func() {
+		select {
+		case tag := <-canceled:
+			slog.Error("Consumer canceled by broker", slog.String("consumer_tag", tag))
+		case amqpErr := <-closed:
+			if amqpErr != nil {
+				slog.Error("Channel closed", slog.String("error", amqpErr.Error()))
+			}
+		}
+		close(lost)
+	}()
+	return lost
+}
+
+// IsConnected reports whether the AMQP connection is still open
+func (client *RabbitClient) IsConnected() bool {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return !client.conn.IsClosed()
+}
+
 func (client *RabbitClient) Close() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
 	client.channel.Close()
 	client.conn.Close()
 }
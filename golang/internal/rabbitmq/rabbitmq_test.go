@@ -0,0 +1,45 @@
+package rabbitmq
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestExchangeDeclareError(t *testing.T) {
+	conflict := &amqp.Error{
+		Code:   amqp.PreconditionFailed,
+		Reason: "PRECONDITION_FAILED - inequivalent arg 'type' for exchange 'conversion_exchange': received 'topic' but current is 'direct'",
+	}
+	err := exchangeDeclareError("conversion_exchange", "topic", conflict)
+	for _, want := range []string{`"conversion_exchange"`, `"topic"`, "EXCHANGE_TYPE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %s", err, want)
+		}
+	}
+
+	// outros erros do broker nao sao tratados como conflito de tipo
+	other := exchangeDeclareError("conversion_exchange", "topic", &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED"})
+	if strings.Contains(other.Error(), "EXCHANGE_TYPE") {
+		t.Errorf("access error reported as a type conflict: %v", other)
+	}
+}
+
+func TestPublishing(t *testing.T) {
+	client := &RabbitClient{}
+	msg := client.publishing([]byte(`{"video_id":1}`), nil)
+	if msg.ContentType != "application/json" || msg.DeliveryMode != amqp.Transient || msg.Headers != nil {
+		t.Errorf("default publishing = %+v", msg)
+	}
+
+	client = &RabbitClient{cfg: Config{ContentType: "text/plain", Persistent: true}}
+	headers := amqp.Table{"status": "completed", "video_id": int64(1)}
+	msg = client.publishing([]byte("done"), headers)
+	if msg.ContentType != "text/plain" || msg.DeliveryMode != amqp.Persistent || string(msg.Body) != "done" {
+		t.Errorf("configured publishing = %+v", msg)
+	}
+	if msg.Headers["status"] != "completed" || msg.Headers["video_id"] != int64(1) {
+		t.Errorf("headers = %v", msg.Headers)
+	}
+}
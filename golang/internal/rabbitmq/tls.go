@@ -0,0 +1,62 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures AMQPS connections; it's only used when the URL scheme is amqps://
+type TLSConfig struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	SkipVerify bool // apenas para desenvolvimento
+}
+
+// validate checks that every configured certificate file exists
+func (c TLSConfig) validate() error {
+	for name, path := range map[string]string{"CA": c.CAFile, "client certificate": c.CertFile, "client key": c.KeyFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("TLS %s file %s: %v", name, path, err)
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("TLS client certificate and key must be configured together")
+	}
+	return nil
+}
+
+// build turns the file paths into a tls.Config with the CA bundle and optional client certificate
+func (c TLSConfig) build() (*tls.Config, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.SkipVerify}
+
+	if c.CAFile != "" {
+		caCert, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"imersaofc/internal/converter"
+)
+
+// QueueInspector reports the backlog of a queue; *rabbitmq.RabbitClient satisfies it
+type QueueInspector interface {
+	QueueDepth(queueName string) (int, error)
+}
+
+// Server exposes operational HTTP endpoints for the worker
+type Server struct {
+	db        *sql.DB
+	queues    QueueInspector
+	queueName string
+	mux       *http.ServeMux
+}
+
+// NewServer creates the HTTP server and registers its routes. queueName is the conversion queue
+// whose depth is exported by /metrics.
+func NewServer(db *sql.DB, queues QueueInspector, queueName string) *Server {
+	s := &Server{
+		db:        db,
+		queues:    queues,
+		queueName: queueName,
+		mux:       http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("GET /failed", s.handleFailed)
+	return s
+}
+
+// ListenAndServe serves the endpoints on addr until the listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	slog.Info("HTTP server listening", slog.String("addr", addr))
+	return http.ListenAndServe(addr, s.mux)
+}
+
+// handleStats returns a JSON snapshot of processed videos and recent errors.
+// The error window defaults to 24h and can be changed with ?window=1h.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid window", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	stats, err := converter.GetStats(s.db, window)
+	if err != nil {
+		slog.Error("Failed to load stats", slog.String("error", err.Error()))
+		http.Error(w, "failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleFailed lists the permanently failed videos, most recent first; ?limit= defaults to 100
+func (s *Server) handleFailed(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	videos, err := converter.ListPermanentlyFailed(r.Context(), s.db, limit)
+	if err != nil {
+		slog.Error("Failed to list failed videos", slog.String("error", err.Error()))
+		http.Error(w, "failed to list failed videos", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, videos)
+}
+
+// handleMetrics exports the conversion queue depth in the Prometheus text format, so an autoscaler
+// (e.g. KEDA) can scale workers on backlog instead of CPU
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	depth, err := s.queues.QueueDepth(s.queueName)
+	if err != nil {
+		slog.Error("Failed to read queue depth", slog.String("queue", s.queueName), slog.String("error", err.Error()))
+		http.Error(w, "failed to read queue depth", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP videoconverter_queue_depth Messages ready in the conversion queue.")
+	fmt.Fprintln(w, "# TYPE videoconverter_queue_depth gauge")
+	fmt.Fprintf(w, "videoconverter_queue_depth{queue=%q} %d\n", s.queueName, depth)
+}
+
+// writeJSON encodes body as the JSON response
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Failed to write response", slog.String("error", err.Error()))
+	}
+}